@@ -9,6 +9,7 @@ import (
 
 	"github.com/gluster/anthill/pkg/apis"
 	"github.com/gluster/anthill/pkg/controller"
+	"github.com/gluster/anthill/pkg/reconciler"
 	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
 	"github.com/operator-framework/operator-sdk/pkg/leader"
 	"github.com/operator-framework/operator-sdk/pkg/ready"
@@ -22,6 +23,13 @@ import (
 
 var log = logf.Log.WithName("cmd")
 
+// metricsPort is the port on which the metrics are served, matching the
+// "metrics" port of the operator's pod
+const metricsPort = 60000
+
+var traceJSON = flag.Bool("trace-json", false,
+	"write a span to stdout, as a line of JSON, for each execution of a reconcile procedure and its actions")
+
 func printVersion() {
 	log.Info(fmt.Sprintf("Go Version: %s", runtime.Version()))
 	log.Info(fmt.Sprintf("Go OS/Arch: %s/%s", runtime.GOOS, runtime.GOARCH))
@@ -39,6 +47,10 @@ func main() {
 
 	printVersion()
 
+	if *traceJSON {
+		reconciler.SetDefaultExporter(reconciler.NewJSONExporter(os.Stdout))
+	}
+
 	namespace, err := k8sutil.GetWatchNamespace()
 	if err != nil {
 		log.Error(err, "failed to get watch namespace")
@@ -68,7 +80,10 @@ func main() {
 	defer r.Unset() // nolint: errcheck
 
 	// Create a new Cmd to provide shared dependencies and start components
-	mgr, err := manager.New(cfg, manager.Options{Namespace: namespace})
+	mgr, err := manager.New(cfg, manager.Options{
+		Namespace:          namespace,
+		MetricsBindAddress: fmt.Sprintf(":%d", metricsPort),
+	})
 	if err != nil {
 		log.Error(err, "")
 		os.Exit(1)
@@ -58,13 +58,33 @@ type GlusterClusterSpec struct {
 	GlusterCA     *Credentials                      `json:"glusterCA,omitempty"`
 	Replication   *GlusterClusterReplicationDetails `json:"replication,omitempty"`
 	NodeTemplates []GlusterNodeTemplate             `json:"nodeTemplates"`
+	// DriftPolicy decides whether the objects managed for the cluster are
+	// changed back when they drift, or if the drift is only reported (the
+	// default)
+	DriftPolicy reconciler.DriftPolicy `json:"driftPolicy,omitempty"`
 }
 
 // GlusterClusterStatus defines the observed state of GlusterCluster
 type GlusterClusterStatus struct {
-	State            string                       `json:"state,omitempty"`
-	ReconcileVersion *int                         `json:"reconcileVersion,omitempty"`
-	ReconcileActions map[string]reconciler.Result `json:"reconcileActions,omitempty"`
+	State            string `json:"state,omitempty"`
+	ReconcileVersion *int   `json:"reconcileVersion,omitempty"`
+	// MigratedVersion is the version of the procedure whose migration last
+	// completed for the cluster, so that it only runs once
+	MigratedVersion *int `json:"migratedVersion,omitempty"`
+	// Conditions has the summary conditions Ready, Progressing and
+	// Degraded, followed by a condition for each procedure level action
+	Conditions []reconciler.Condition `json:"conditions,omitempty"`
+	// Failure is set when reconciliation has stopped until the spec changes
+	Failure *reconciler.Failure `json:"failure,omitempty"`
+	// Plan lists the changes that reconciling would make while the CR is
+	// in plan-only mode (see PlanOnlyAnnotation)
+	Plan []reconciler.PlannedChange `json:"plan,omitempty"`
+	// Drift lists the objects managed by the operator whose fields were
+	// changed by someone else (see Spec.DriftPolicy)
+	Drift []reconciler.Drift `json:"drift,omitempty"`
+	// History records what the last executions of the procedure did,
+	// oldest first
+	History []reconciler.HistoryEntry `json:"history,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
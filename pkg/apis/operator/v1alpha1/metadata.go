@@ -0,0 +1,15 @@
+package v1alpha1
+
+// PlanOnlyAnnotation, when set to "true" on a GlusterCluster or GlusterNode,
+// prevents the operator from changing the system on behalf of the CR.
+// Instead, the changes that reconciling the CR would make are written to its
+// .Status.Plan, and the CR itself is left as it is (e.g., it doesn't get
+// the TeardownFinalizer). That includes deleting a CR that the operator has
+// acted on: the cleanups that tearing it down would run are planned, and the
+// CR is kept until the annotation is removed.
+const PlanOnlyAnnotation = "operator.gluster.org/plan-only"
+
+// TeardownFinalizer is added to GlusterClusters and GlusterNodes so that
+// the operator can remove everything that was deployed for them, in a safe
+// order, before they are deleted.
+const TeardownFinalizer = "operator.gluster.org/teardown"
@@ -21,6 +21,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	reconciler "github.com/gluster/anthill/pkg/reconciler"
 	v1 "k8s.io/api/core/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
@@ -47,7 +48,7 @@ func (in *GlusterCluster) DeepCopyInto(out *GlusterCluster) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -178,6 +179,47 @@ func (in *GlusterClusterSpec) DeepCopy() *GlusterClusterSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GlusterClusterStatus) DeepCopyInto(out *GlusterClusterStatus) {
 	*out = *in
+	if in.ReconcileVersion != nil {
+		in, out := &in.ReconcileVersion, &out.ReconcileVersion
+		*out = new(int)
+		**out = **in
+	}
+	if in.MigratedVersion != nil {
+		in, out := &in.MigratedVersion, &out.MigratedVersion
+		*out = new(int)
+		**out = **in
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]reconciler.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Failure != nil {
+		in, out := &in.Failure, &out.Failure
+		*out = new(reconciler.Failure)
+		**out = **in
+	}
+	if in.Plan != nil {
+		in, out := &in.Plan, &out.Plan
+		*out = make([]reconciler.PlannedChange, len(*in))
+		copy(*out, *in)
+	}
+	if in.Drift != nil {
+		in, out := &in.Drift, &out.Drift
+		*out = make([]reconciler.Drift, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]reconciler.HistoryEntry, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -197,7 +239,7 @@ func (in *GlusterNode) DeepCopyInto(out *GlusterNode) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -276,6 +318,11 @@ func (in *GlusterNodeList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GlusterNodeSpec) DeepCopyInto(out *GlusterNodeSpec) {
 	*out = *in
+	if in.ReconcileVersion != nil {
+		in, out := &in.ReconcileVersion, &out.ReconcileVersion
+		*out = new(int)
+		**out = **in
+	}
 	if in.ExternalInfo != nil {
 		in, out := &in.ExternalInfo, &out.ExternalInfo
 		*out = new(GlusterNodeExternal)
@@ -309,6 +356,47 @@ func (in *GlusterNodeSpec) DeepCopy() *GlusterNodeSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GlusterNodeStatus) DeepCopyInto(out *GlusterNodeStatus) {
 	*out = *in
+	if in.ReconcileVersion != nil {
+		in, out := &in.ReconcileVersion, &out.ReconcileVersion
+		*out = new(int)
+		**out = **in
+	}
+	if in.MigratedVersion != nil {
+		in, out := &in.MigratedVersion, &out.MigratedVersion
+		*out = new(int)
+		**out = **in
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]reconciler.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Failure != nil {
+		in, out := &in.Failure, &out.Failure
+		*out = new(reconciler.Failure)
+		**out = **in
+	}
+	if in.Plan != nil {
+		in, out := &in.Plan, &out.Plan
+		*out = make([]reconciler.PlannedChange, len(*in))
+		copy(*out, *in)
+	}
+	if in.Drift != nil {
+		in, out := &in.Drift, &out.Drift
+		*out = make([]reconciler.Drift, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]reconciler.HistoryEntry, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
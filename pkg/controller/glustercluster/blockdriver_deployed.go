@@ -0,0 +1,55 @@
+package glustercluster
+
+import (
+	"context"
+
+	"github.com/gluster/anthill/pkg/reconciler"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// blockDriver is the name of the gluster-block CSI driver in the spec
+const blockDriver = "gluster-block"
+
+var glusterBlockDriver = &csiDriver{
+	name: blockDriver,
+	actions: []*reconciler.Action{
+		glusterBlockConfigValid,
+		glusterBlockProvisionerDeployed,
+		glusterBlockNodeDeployed,
+	},
+}
+
+var glusterBlockConfigValid = driverConfigValid("glusterBlockConfigValid", blockDriver)
+
+var glusterBlockProvisionerDeployed = reconciler.NewAction(
+	"glusterBlockProvisionerDeployed",
+	[]*reconciler.Action{
+		glusterNodesCreated,
+		glusterBlockConfigValid,
+	},
+	func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
+		return reconciler.Result{Status: corev1.ConditionTrue, Message: "it's true"}, nil
+	},
+	reconciler.WithCleanup(func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
+		return reconciler.Result{Status: corev1.ConditionTrue, Message: "it's gone"}, nil
+	}),
+	reconciler.When(driverEnabled(blockDriver)),
+)
+
+var glusterBlockNodeDeployed = reconciler.NewAction(
+	"glusterBlockNodeDeployed",
+	[]*reconciler.Action{
+		glusterNodesCreated,
+		glusterBlockConfigValid,
+	},
+	func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
+		return reconciler.Result{Status: corev1.ConditionTrue, Message: "it's true"}, nil
+	},
+	reconciler.WithCleanup(func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
+		return reconciler.Result{Status: corev1.ConditionTrue, Message: "it's gone"}, nil
+	}),
+	reconciler.When(driverEnabled(blockDriver)),
+)
@@ -1,8 +1,10 @@
 package glustercluster
 
 import (
+	"context"
 	"fmt"
 
+	operatorv1alpha1 "github.com/gluster/anthill/pkg/apis/operator/v1alpha1"
 	"github.com/gluster/anthill/pkg/reconciler"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -12,45 +14,102 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
-var glusterFuseProvisionerDeployed = reconciler.NewAction(
+// fuseDriver is the name of the gluster-fuse CSI driver in the spec
+const fuseDriver = "gluster-fuse"
+
+var glusterFuseDriver = &csiDriver{
+	name: fuseDriver,
+	actions: []*reconciler.Action{
+		glusterFuseConfigValid,
+		glusterFuseProvisionerDeployed,
+		glusterFuseAttacherDeployed,
+		glusterFuseNodeDeployed,
+	},
+}
+
+var glusterFuseConfigValid = driverConfigValid("glusterFuseConfigValid", fuseDriver)
+
+// csiProvisionerImage is the image of the external CSI provisioner
+const csiProvisionerImage = "quay.io/k8scsi/csi-provisioner:v1.0.1"
+
+var glusterFuseProvisionerDeployed = reconciler.EnsureObject(
 	"glusterFuseProvisionerDeployed",
-	[]*reconciler.Action{},
-	func(request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
-		clustername := "clustername"
-		clusternamespace := "clusternamespace"
-		servicename := fmt.Sprintf("%v-csi-provisioner", clustername)
-		statefulSet := appsv1.StatefulSet{
+	[]*reconciler.Action{
+		glusterNodesCreated,
+		glusterFuseConfigValid,
+	},
+	func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (runtime.Object, metav1.Object, error) {
+		cluster := &operatorv1alpha1.GlusterCluster{}
+		if err := client.Get(ctx, request.NamespacedName, cluster); err != nil {
+			return nil, nil, err
+		}
+		labels := map[string]string{
+			"app.kubernetes.io/part-of":   fmt.Sprintf("glustercluster/%v", cluster.Name),
+			"app.kubernetes.io/component": "csi-driver",
+			"app.kubernetes.io/name":      "csi-provisioner",
+		}
+		replicas := int32(1)
+		statefulSet := &appsv1.StatefulSet{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      fmt.Sprintf("csi-provisioner-%v", clustername),
-				Namespace: fmt.Sprintf("csi-provisioner-%v", clusternamespace),
-				Labels: map[string]string{
-					"app.kubernetes.io/part-of":   fmt.Sprintf("glustercluster/%v", clustername),
-					"app.kubernetes.io/component": "csi-driver",
-					"app.kubernetes.io/name":      "csi-provisioner",
-				},
+				Name:      fmt.Sprintf("csi-provisioner-%v", cluster.Name),
+				Namespace: cluster.Namespace,
+				Labels:    labels,
 			},
 			Spec: appsv1.StatefulSetSpec{
-				ServiceName: servicename,
+				Replicas:    &replicas,
+				ServiceName: fmt.Sprintf("%v-csi-provisioner", cluster.Name),
+				Selector:    &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: labels},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{
+							Name:  "csi-provisioner",
+							Image: csiProvisionerImage,
+							Args: []string{
+								"--provisioner=org.gluster.glusterfs",
+								"--csi-address=$(ADDRESS)",
+							},
+							Env: []corev1.EnvVar{{
+								Name:  "ADDRESS",
+								Value: "/var/lib/csi/sockets/pluginproxy/csi.sock",
+							}},
+						}},
+					},
+				},
 			},
 		}
-		fmt.Printf(statefulSet.Name)
-		return reconciler.Result{Status: corev1.ConditionTrue, Message: "it's true"}, nil
+		return statefulSet, cluster, nil
 	},
+	reconciler.When(driverEnabled(fuseDriver)),
 )
 
 var glusterFuseAttacherDeployed = reconciler.NewAction(
 	"glusterFuseAttachedDeployed",
-	[]*reconciler.Action{},
-	func(request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
+	[]*reconciler.Action{
+		glusterNodesCreated,
+		glusterFuseConfigValid,
+	},
+	func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
 
 		return reconciler.Result{Status: corev1.ConditionTrue, Message: "it's true"}, nil
 	},
+	reconciler.WithCleanup(func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
+		return reconciler.Result{Status: corev1.ConditionTrue, Message: "it's gone"}, nil
+	}),
+	reconciler.When(driverEnabled(fuseDriver)),
 )
 
 var glusterFuseNodeDeployed = reconciler.NewAction(
 	"glusterFuseNodeDeployed",
-	[]*reconciler.Action{},
-	func(request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
+	[]*reconciler.Action{
+		glusterNodesCreated,
+		glusterFuseConfigValid,
+	},
+	func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
 		return reconciler.Result{Status: corev1.ConditionTrue, Message: "it's true"}, nil
 	},
+	reconciler.WithCleanup(func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
+		return reconciler.Result{Status: corev1.ConditionTrue, Message: "it's gone"}, nil
+	}),
+	reconciler.When(driverEnabled(fuseDriver)),
 )
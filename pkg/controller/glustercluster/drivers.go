@@ -0,0 +1,175 @@
+package glustercluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	operatorv1alpha1 "github.com/gluster/anthill/pkg/apis/operator/v1alpha1"
+	"github.com/gluster/anthill/pkg/reconciler"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Driver is a CSI driver that can be listed in the spec of a GlusterCluster.
+// To add a driver, implement Driver and add it to availableDrivers.
+type Driver interface {
+	// Name is the name of the driver in GlusterClusterSpec.Drivers
+	Name() string
+	// Actions are the actions that deploy the driver. They are added to
+	// the cluster procedure, must include the driver's driverConfigValid
+	// action and have it as a prereq, and should only apply while the
+	// driver is listed (see driverEnabled). Their cleanups tear the driver
+	// down.
+	Actions() []*reconciler.Action
+	// Validate checks the spec of the cluster for use with the driver
+	Validate(cluster *operatorv1alpha1.GlusterCluster) error
+}
+
+// csiDriver is a Driver defined by its name, actions and an optional
+// validation function
+type csiDriver struct {
+	name     string
+	actions  []*reconciler.Action
+	validate func(cluster *operatorv1alpha1.GlusterCluster) error
+}
+
+func (d *csiDriver) Name() string {
+	return d.name
+}
+
+func (d *csiDriver) Actions() []*reconciler.Action {
+	return d.actions
+}
+
+func (d *csiDriver) Validate(cluster *operatorv1alpha1.GlusterCluster) error {
+	if d.validate == nil {
+		return nil
+	}
+	return d.validate(cluster)
+}
+
+// availableDrivers are the drivers that the operator can deploy
+var availableDrivers = []Driver{
+	glusterFuseDriver,
+	glusterBlockDriver,
+}
+
+// driverRegistry maps the names of drivers to them
+type driverRegistry map[string]Driver
+
+// registry holds availableDrivers. It is filled in by init since the
+// actions of the drivers refer to it.
+var registry driverRegistry
+
+func init() {
+	registry = newDriverRegistry(availableDrivers)
+}
+
+// newDriverRegistry returns a registry of the drivers. It panics if two of
+// them have the same name.
+func newDriverRegistry(drivers []Driver) driverRegistry {
+	r := make(driverRegistry)
+	for _, d := range drivers {
+		if _, ok := r[d.Name()]; ok {
+			panic(fmt.Sprintf("driver %s is registered twice", d.Name()))
+		}
+		r[d.Name()] = d
+	}
+	return r
+}
+
+// names returns the sorted names of the registered drivers
+func (r driverRegistry) names() []string {
+	var names []string
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// driverActions returns the actions of the drivers, to be added to a
+// procedure
+func driverActions(drivers []Driver) []*reconciler.Action {
+	var actions []*reconciler.Action
+	for _, d := range drivers {
+		actions = append(actions, d.Actions()...)
+	}
+	return actions
+}
+
+// driverEnabled returns a Predicate that holds if the driver is listed in
+// the spec of the GlusterCluster
+func driverEnabled(driver string) reconciler.Predicate {
+	return func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (bool, error) {
+		cluster := &operatorv1alpha1.GlusterCluster{}
+		if err := client.Get(ctx, request.NamespacedName, cluster); err != nil {
+			return false, err
+		}
+		for _, d := range cluster.Spec.Drivers {
+			if d == driver {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// driverConfigValid returns the action that validates the spec of the
+// cluster for use w/ the named driver. It is a prereq of the driver's other
+// actions, so that an invalid config only keeps that driver from being
+// deployed. It is False, rather than failing, so that the rest of the
+// cluster is still reconciled.
+func driverConfigValid(actionName, driver string) *reconciler.Action {
+	return reconciler.NewAction(
+		actionName,
+		[]*reconciler.Action{},
+		func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
+			cluster := &operatorv1alpha1.GlusterCluster{}
+			if err := client.Get(ctx, request.NamespacedName, cluster); err != nil {
+				return reconciler.Result{}, err
+			}
+			if err := registry[driver].Validate(cluster); err != nil {
+				return reconciler.Result{
+					Status:  corev1.ConditionFalse,
+					Message: fmt.Sprintf("invalid config for driver %s: %v", driver, err),
+				}, nil
+			}
+			return reconciler.Result{Status: corev1.ConditionTrue, Message: fmt.Sprintf("config for driver %s is valid", driver)}, nil
+		},
+		reconciler.ReadOnly(),
+		reconciler.When(driverEnabled(driver)),
+	)
+}
+
+// driversValid reports the drivers listed in the spec that are unknown. They
+// have no actions, so the other drivers are deployed regardless.
+var driversValid = reconciler.NewAction(
+	"driversValid",
+	[]*reconciler.Action{},
+	func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
+		cluster := &operatorv1alpha1.GlusterCluster{}
+		if err := client.Get(ctx, request.NamespacedName, cluster); err != nil {
+			return reconciler.Result{}, err
+		}
+		var unknown []string
+		for _, name := range cluster.Spec.Drivers {
+			if _, ok := registry[name]; !ok {
+				unknown = append(unknown, name)
+			}
+		}
+		if len(unknown) > 0 {
+			return reconciler.Result{
+				Status: corev1.ConditionFalse,
+				Message: fmt.Sprintf("unknown drivers: %s (available: %s)",
+					strings.Join(unknown, ", "), strings.Join(registry.names(), ", ")),
+			}, nil
+		}
+		return reconciler.Result{Status: corev1.ConditionTrue, Message: "all drivers are known"}, nil
+	},
+	reconciler.ReadOnly(),
+)
@@ -1,6 +1,9 @@
 package glustercluster
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/gluster/anthill/pkg/reconciler"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -8,20 +11,34 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+// etcdClientEndpoint is the client URL of the etcd cluster used by the
+// Gluster pods
+var etcdClientEndpoint = reconciler.NewValue("etcdClientEndpoint", "")
+
 var etcdClusterCreated = reconciler.NewAction(
 	"etcdClusterCreated",
 	[]*reconciler.Action{
 		etcdCRDExists,
 	},
-	func(request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
+	func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
+		// etcd-operator exposes the cluster via the <name>-client service
+		endpoint := fmt.Sprintf("http://%s-etcd-client.%s.svc:2379", request.Name, request.Namespace)
+		if err := etcdClientEndpoint.Set(ctx, endpoint); err != nil {
+			return reconciler.Result{}, err
+		}
 		return reconciler.Result{Status: corev1.ConditionTrue, Message: "it's true"}, nil
 	},
+	reconciler.Produces(etcdClientEndpoint),
+	reconciler.WithCleanup(func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
+		return reconciler.Result{Status: corev1.ConditionTrue, Message: "it's gone"}, nil
+	}),
 )
 
 var etcdCRDExists = reconciler.NewAction(
 	"etcdCRDExists",
 	[]*reconciler.Action{},
-	func(request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
+	func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
 		return reconciler.Result{Status: corev1.ConditionTrue, Message: "it's true"}, nil
 	},
+	reconciler.ReadOnly(),
 )
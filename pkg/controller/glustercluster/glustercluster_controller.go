@@ -1,6 +1,9 @@
 package glustercluster
 
 import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -11,6 +14,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	operatorv1alpha1 "github.com/gluster/anthill/pkg/apis/operator/v1alpha1"
+	"github.com/gluster/anthill/pkg/reconciler"
 )
 
 /**
@@ -21,12 +25,25 @@ import (
 // Add creates a new GlusterCluster Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager) error {
-	return add(mgr, newReconciler(mgr))
+	// Actions in flight are cancelled when the manager is told to stop
+	stop := reconciler.NewStopContext()
+	if err := mgr.Add(stop); err != nil {
+		return err
+	}
+	// Metrics are labelled w/ the kind of CR being reconciled
+	ctx := reconciler.WithKind(stop.Context(), "GlusterCluster")
+	return add(mgr, newReconciler(ctx, mgr))
 }
 
 // newReconciler returns a new reconcile.Reconciler
-func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileGlusterCluster{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+func newReconciler(ctx context.Context, mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileGlusterCluster{
+		client:  mgr.GetClient(),
+		scheme:  mgr.GetScheme(),
+		ctx:     ctx,
+		backoff: reconciler.NewBackoff(),
+		events:  reconciler.NewEventRecorder(mgr.GetRecorder("glustercluster-controller")),
+	}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
@@ -49,6 +66,16 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		IsController: true,
 		OwnerType:    &operatorv1alpha1.GlusterCluster{},
 	})
+	if err != nil {
+		return err
+	}
+
+	// Watch the StatefulSets ensured by the procedure, so their rollouts
+	// are noticed
+	err = c.Watch(&source.Kind{Type: &appsv1.StatefulSet{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &operatorv1alpha1.GlusterCluster{},
+	})
 	return err
 }
 
@@ -60,4 +87,10 @@ type ReconcileGlusterCluster struct {
 	// that reads objects from the cache and writes to the apiserver
 	client client.Client
 	scheme *runtime.Scheme
+	// ctx is cancelled when the operator is shutting down
+	ctx context.Context
+	// backoff determines when to requeue each CR
+	backoff *reconciler.Backoff
+	// events reports changes in the actions' results as Events on the CR
+	events *reconciler.EventRecorder
 }
@@ -1,6 +1,9 @@
 package glustercluster
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/gluster/anthill/pkg/reconciler"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -10,8 +13,18 @@ import (
 
 var glusterNodesCreated = reconciler.NewAction(
 	"glusterNodesCreated",
-	[]*reconciler.Action{},
-	func(request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
-		return reconciler.Result{Status: corev1.ConditionTrue, Message: "it's true"}, nil
+	[]*reconciler.Action{
+		etcdClusterCreated,
+	},
+	func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
+		endpoint, err := etcdClientEndpoint.Get(ctx)
+		if err != nil {
+			return reconciler.Result{}, err
+		}
+		return reconciler.Result{Status: corev1.ConditionTrue, Message: fmt.Sprintf("using etcd at %s", endpoint)}, nil
 	},
+	reconciler.Consumes(etcdClientEndpoint),
+	reconciler.WithCleanup(func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
+		return reconciler.Result{Status: corev1.ConditionTrue, Message: "it's gone"}, nil
+	}),
 )
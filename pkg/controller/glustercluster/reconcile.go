@@ -1,9 +1,8 @@
 package glustercluster
 
 import (
-	"context"
-
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 
@@ -13,11 +12,8 @@ import (
 )
 
 var (
-	log                                         = logf.Log.WithName("controller_glustercluster")
-	allProcedures      reconciler.ProcedureList = []reconciler.Procedure{*ProcedureV1}
-	reconcileProcedure *reconciler.Procedure
-	err                error
-	procedureStatus    *reconciler.ProcedureStatus
+	log                                    = logf.Log.WithName("controller_glustercluster")
+	allProcedures reconciler.ProcedureList = []reconciler.Procedure{*ProcedureV1}
 )
 
 // Reconcile reads that state of the cluster for a GlusterCluster object and makes changes based on the state read
@@ -31,12 +27,15 @@ func (r *ReconcileGlusterCluster) Reconcile(request reconcile.Request) (reconcil
 
 	// Fetch the GlusterCluster instance
 	instance := &operatorv1alpha1.GlusterCluster{}
-	err = r.client.Get(context.TODO(), request.NamespacedName, instance)
+	err := r.client.Get(r.ctx, request.NamespacedName, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
+			r.backoff.Forget(request.NamespacedName)
+			reconciler.ForgetMetrics(r.ctx, request.NamespacedName)
+			r.events.Forget(request.NamespacedName)
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
@@ -45,41 +44,174 @@ func (r *ReconcileGlusterCluster) Reconcile(request reconcile.Request) (reconcil
 
 	// Get current reconcile version from CR
 	version := instance.Status.ReconcileVersion
-	// If no current version, use highest version to reconcile
-	reconcileProcedure, err = allProcedures.NewestCompatible(version)
+
+	// Tear down everything that was deployed before letting the CR go. This
+	// is done w/ the procedure that deployed it, whether or not it can be
+	// upgraded.
+	if instance.DeletionTimestamp != nil {
+		if !reconciler.HasFinalizer(instance, operatorv1alpha1.TeardownFinalizer) {
+			return reconcile.Result{}, nil
+		}
+		teardownProcedure, err := allProcedures.Deployed(version)
+		if err != nil {
+			log.Error(err, "Failed to find a procedure to tear down with.")
+			return reconcile.Result{}, err
+		}
+		// In plan-only mode, record what tearing down would do instead of
+		// doing it. The CR stays until the mode is turned off.
+		if instance.Annotations[operatorv1alpha1.PlanOnlyAnnotation] == "true" {
+			instance.Status.Plan = teardownProcedure.PlanTeardown()
+			if err := r.client.Update(r.ctx, instance); err != nil && !errors.IsNotFound(err) {
+				return reconcile.Result{}, err
+			}
+			return reconcile.Result{}, nil
+		}
+		procedureStatus, err := teardownProcedure.Teardown(r.ctx, request, r.client, r.scheme)
+		if procedureStatus == nil {
+			return reconcile.Result{}, err
+		}
+		if err != nil {
+			log.Error(err, "Failed to tear down.")
+			return reconcile.Result{}, err
+		}
+		if !procedureStatus.FullyReconciled {
+			// Check on the remaining cleanups once the actions' hints
+			// and backoff allow
+			return reconcile.Result{RequeueAfter: r.backoff.RequeueAfter(request.NamespacedName, procedureStatus)}, nil
+		}
+		reconciler.RemoveFinalizer(instance, operatorv1alpha1.TeardownFinalizer)
+		if err := r.client.Update(r.ctx, instance); err != nil && !errors.IsNotFound(err) {
+			return reconcile.Result{}, err
+		}
+		r.backoff.Forget(request.NamespacedName)
+		r.events.Forget(request.NamespacedName)
+		return reconcile.Result{}, nil
+	}
+
+	// If no current version, use highest version to reconcile. Otherwise,
+	// step through any intermediate versions needed to reach it.
+	upgradePath, err := allProcedures.UpgradePath(version)
 	if err != nil {
 		log.Error(err, "Failed to get the reconcile version.")
 		return reconcile.Result{}, err
 	}
+	reconcileProcedure := upgradePath[0]
 
-	// Execute the reconcile procedure.
-	procedureStatus, err = reconcileProcedure.Execute(request, r.client, r.scheme)
-	if err != nil {
-		log.Error(err, "Failed to execute procedure.")
-		return reconcile.Result{}, err
+	// A terminal failure stops reconciliation until the spec is changed
+	if instance.Status.Failure.Blocks(instance.Spec) {
+		reqLogger.Info("Not reconciling until the spec is changed", "Failure", instance.Status.Failure.Message)
+		return reconcile.Result{}, nil
 	}
-	// Walk ProcedureStatus.Results and add to the CR status
-	reconcileActionStatus := make(map[string]reconciler.Result)
-	for _, result := range procedureStatus.Results {
-		reconcileActionStatus[result.Name] = result.Result
+
+	// Objects that have drifted are handled according to the CR's policy
+	ctx := reconciler.WithDriftPolicy(r.ctx, instance.Spec.DriftPolicy)
+
+	// In plan-only mode, record what would be done instead of doing it
+	if instance.Annotations[operatorv1alpha1.PlanOnlyAnnotation] == "true" {
+		plan, err := reconcileProcedure.Plan(ctx, request, r.client, r.scheme)
+		if err != nil {
+			// Don't record a plan that may be incomplete
+			log.Error(err, "Failed to plan procedure.")
+			return reconcile.Result{}, err
+		}
+		instance.Status.Plan = plan
+		if err := r.client.Update(r.ctx, instance); err != nil {
+			return reconcile.Result{}, err
+		}
+		// The plan goes stale as the system changes
+		return reconcile.Result{RequeueAfter: r.backoff.ResyncInterval}, nil
+	}
+	instance.Status.Plan = nil
+
+	// Make sure the CR isn't deleted before it has been torn down. This
+	// is only done once the operator acts on the CR, so that plan-only
+	// mode leaves the CR as it is (except for the plan).
+	if reconciler.AddFinalizer(instance, operatorv1alpha1.TeardownFinalizer) {
+		if err := r.client.Update(r.ctx, instance); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	// Migrate from the layout of the previous version before the procedure
+	// acts on it. That is recorded in the status, so that it is only done
+	// once, and a failure is recorded like those of the actions.
+	var procedureStatus *reconciler.ProcedureStatus
+	if migrated := instance.Status.MigratedVersion; migrated == nil || *migrated != reconcileProcedure.Version() {
+		if merr := reconcileProcedure.Migrate(ctx, version, request, r.client, r.scheme); merr != nil {
+			log.Error(merr, "Failed to migrate to the procedure version.", "Version", reconcileProcedure.Version())
+			procedureStatus, err = reconciler.MigrationStatus(merr)
+		} else {
+			migratedVersion := reconcileProcedure.Version()
+			instance.Status.MigratedVersion = &migratedVersion
+			if err := r.client.Update(r.ctx, instance); err != nil {
+				return reconcile.Result{}, err
+			}
+		}
+	}
+
+	if procedureStatus == nil {
+		// Execute the reconcile procedure.
+		procedureStatus, err = reconcileProcedure.Execute(ctx, request, r.client, r.scheme)
+		if procedureStatus == nil {
+			// Execution was interrupted, so there's nothing to record
+			return reconcile.Result{}, err
+		}
+	}
+
+	// Report the actions whose results changed since the last reconcile,
+	// and keep a record of them
+	previous := reconciler.ActionResults(instance.Status.Conditions)
+	r.events.Record(instance, request.NamespacedName, previous, procedureStatus.Results)
+	instance.Status.History = reconciler.RecordHistory(instance.Status.History, previous, procedureStatus, err,
+		reconcileProcedure.Version(), metav1.Now())
+	if len(procedureStatus.WaitingForBudget) > 0 {
+		reqLogger.Info("Actions are waiting for the disruption budget", "Actions", procedureStatus.WaitingForBudget)
+	}
+	r.events.RecordDrift(instance, instance.Status.Drift, procedureStatus.Drift)
+	if len(procedureStatus.Drift) > 0 {
+		reqLogger.Info("Managed objects have drifted", "Drift", procedureStatus.Drift)
 	}
-	instance.Status.ReconcileActions = reconcileActionStatus
+	instance.Status.Drift = procedureStatus.Drift
+
+	// Record the results as conditions of the CR. This is done even if some
+	// actions failed so that every problem is visible.
+	instance.Status.Conditions = reconciler.NewConditions(instance.Status.Conditions, procedureStatus, instance.Generation, metav1.Now())
+
+	if err != nil {
+		failure, ferr := reconciler.NewFailure(err, instance.Spec)
+		if ferr != nil {
+			return reconcile.Result{}, ferr
+		}
+		instance.Status.Failure = failure
+		if uerr := r.client.Update(r.ctx, instance); uerr != nil {
+			return reconcile.Result{}, uerr
+		}
+		if failure == nil {
+			// Let the controller retry the request
+			log.Error(err, "Failed to execute procedure.")
+			return reconcile.Result{}, err
+		}
+		// Retrying won't help, so don't requeue
+		log.Error(err, "Failed to execute procedure; not retrying until the spec is changed.")
+		return reconcile.Result{}, nil
+	}
+	instance.Status.Failure = nil
 
 	if !procedureStatus.FullyReconciled {
-		err = r.client.Update(context.TODO(), instance)
+		err = r.client.Update(r.ctx, instance)
 		if err != nil {
 
 			return reconcile.Result{}, err
 		}
-		//requeue immediately
-		return reconcile.Result{Requeue: true}, nil
+		// requeue once the actions' hints and backoff allow
+		return reconcile.Result{RequeueAfter: r.backoff.RequeueAfter(request.NamespacedName, procedureStatus)}, nil
 	}
 	// if ProcedureStatus.FullyReconciled
 	//   update reconcile version in the CR to match the Procedure version
 	//   use a timed reconcile requeue //left this part out. Why requeue?
 	newVersion := reconcileProcedure.Version()
 	instance.Status.ReconcileVersion = &newVersion
-	err = r.client.Update(context.TODO(), instance)
+	err = r.client.Update(r.ctx, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
@@ -90,7 +222,11 @@ func (r *ReconcileGlusterCluster) Reconcile(request reconcile.Request) (reconcil
 		// Error reading the object - requeue the request.
 		return reconcile.Result{}, err
 	}
-	// use a timed reconcile requeue //TODO: implement backoff
-	return reconcile.Result{RequeueAfter: 3e+10}, nil
+	if len(upgradePath) > 1 {
+		// Continue w/ the next step of the upgrade right away
+		return reconcile.Result{Requeue: true}, nil
+	}
+	// use a timed reconcile requeue
+	return reconcile.Result{RequeueAfter: r.backoff.RequeueAfter(request.NamespacedName, procedureStatus)}, nil
 
 }
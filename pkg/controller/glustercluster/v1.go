@@ -5,14 +5,12 @@ import (
 )
 
 // ProcedureV1 is Procedure version 1
-var ProcedureV1 = reconciler.NewProcedure(
+var ProcedureV1 = reconciler.MustNewProcedure(
 	0,
 	0,
-	[]*reconciler.Action{
+	append([]*reconciler.Action{
 		etcdClusterCreated,
-		glusterFuseProvisionerDeployed,
-		glusterFuseAttacherDeployed,
-		glusterFuseNodeDeployed,
 		glusterNodesCreated,
-	},
+		driversValid,
+	}, driverActions(availableDrivers)...),
 )
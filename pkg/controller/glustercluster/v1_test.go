@@ -0,0 +1,296 @@
+package glustercluster
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	operatorv1alpha1 "github.com/gluster/anthill/pkg/apis/operator/v1alpha1"
+	"github.com/gluster/anthill/pkg/reconciler/reconcilertest"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestProceduresAreValid(t *testing.T) {
+	reconcilertest.CheckProcedures(t, allProcedures)
+}
+
+func TestProcedureDiagramsAreCurrent(t *testing.T) {
+	p, err := allProcedures.Newest()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reconcilertest.CheckDiagrams(t, p, "GlusterCluster", "../../../docs/Developers/Design/glustercluster_procedure")
+}
+
+func TestProceduresDoNotDependOnOrder(t *testing.T) {
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "name",
+			Namespace: "namespace",
+		},
+	}
+	newClient := func() client.Client {
+		return fake.NewFakeClient(newCluster(request, fuseDriver))
+	}
+	// The procedure has too many orderings to try them all
+	var seeds []int64
+	for seed := int64(1); seed <= 100; seed++ {
+		seeds = append(seeds, seed)
+	}
+	for i := range allProcedures {
+		reconcilertest.CheckSeeds(t, &allProcedures[i], seeds, request, newClient, scheme.Scheme)
+	}
+}
+
+func TestDriversFollowSpec(t *testing.T) {
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "name",
+			Namespace: "namespace",
+		},
+	}
+	var tests = [][]string{
+		{fuseDriver},
+		{blockDriver},
+		{fuseDriver, blockDriver},
+		nil,
+	}
+	for _, drivers := range tests {
+		client := fake.NewFakeClient(newCluster(request, drivers...))
+		status, err := ProcedureV1.Execute(context.TODO(), request, client, scheme.Scheme)
+		if err != nil {
+			t.Fatalf("drivers %v: unexpected error: %v", drivers, err)
+		}
+		wantSkipped := make(map[string]bool)
+		for _, d := range availableDrivers {
+			for _, a := range d.Actions() {
+				wantSkipped[a.Name] = true
+			}
+		}
+		for _, name := range drivers {
+			for _, a := range registry[name].Actions() {
+				wantSkipped[a.Name] = false
+			}
+		}
+		for _, ar := range status.Results {
+			if ar.Skipped != wantSkipped[ar.Name] {
+				t.Errorf("drivers %v: expected %s to be skipped: %v; got %+v", drivers, ar.Name, wantSkipped[ar.Name], ar)
+			}
+		}
+		// The provisioner of the fuse driver can't roll out w/o a cluster
+		if status.FullyReconciled == !wantSkipped[glusterFuseProvisionerDeployed.Name] {
+			t.Errorf("drivers %v: unexpected FullyReconciled: %v; got %+v", drivers, status.FullyReconciled, status.Results)
+		}
+	}
+}
+
+func TestFuseProvisionerIsOwned(t *testing.T) {
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "name",
+			Namespace: "namespace",
+		},
+	}
+	client := fake.NewFakeClient(newCluster(request, fuseDriver))
+	if _, err := ProcedureV1.Execute(context.TODO(), request, client, scheme.Scheme); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ss := &appsv1.StatefulSet{}
+	key := types.NamespacedName{Name: "csi-provisioner-name", Namespace: "namespace"}
+	if err := client.Get(context.TODO(), key, ss); err != nil {
+		t.Fatalf("expected the provisioner to be created: %v", err)
+	}
+	owner := metav1.GetControllerOf(ss)
+	if owner == nil || owner.Kind != "GlusterCluster" || owner.Name != request.Name {
+		t.Errorf("expected the cluster to own the provisioner; got %+v", owner)
+	}
+}
+
+func TestDisabledDriversAreRemoved(t *testing.T) {
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "name",
+			Namespace: "namespace",
+		},
+	}
+	client := fake.NewFakeClient(newCluster(request, fuseDriver))
+	if _, err := ProcedureV1.Execute(context.TODO(), request, client, scheme.Scheme); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ss := &appsv1.StatefulSet{}
+	key := types.NamespacedName{Name: "csi-provisioner-name", Namespace: "namespace"}
+	if err := client.Get(context.TODO(), key, ss); err != nil {
+		t.Fatalf("expected the provisioner to be created: %v", err)
+	}
+
+	// Disable the driver
+	cluster := &operatorv1alpha1.GlusterCluster{}
+	if err := client.Get(context.TODO(), request.NamespacedName, cluster); err != nil {
+		t.Fatalf("unable to get the cluster: %v", err)
+	}
+	cluster.Spec.Drivers = nil
+	if err := client.Update(context.TODO(), cluster); err != nil {
+		t.Fatalf("unable to update the cluster: %v", err)
+	}
+	status, err := ProcedureV1.Execute(context.TODO(), request, client, scheme.Scheme)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.Get(context.TODO(), key, ss); !errors.IsNotFound(err) {
+		t.Errorf("expected the provisioner to be deleted; got %v", err)
+	}
+	for _, ar := range status.Results {
+		if ar.Name == glusterFuseProvisionerDeployed.Name && ar.Skipped {
+			t.Errorf("expected %s to be cleaning up; got %+v", ar.Name, ar.Result)
+		}
+	}
+
+	// Once it is gone, the driver's actions are skipped
+	status, err = ProcedureV1.Execute(context.TODO(), request, client, scheme.Scheme)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, a := range glusterFuseDriver.Actions() {
+		for _, ar := range status.Results {
+			if ar.Name == a.Name && !ar.Skipped {
+				t.Errorf("expected %s to be skipped; got %+v", ar.Name, ar.Result)
+			}
+		}
+	}
+}
+
+func TestUnknownDriversAreReported(t *testing.T) {
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "name",
+			Namespace: "namespace",
+		},
+	}
+	client := fake.NewFakeClient(newCluster(request, fuseDriver, "gluster-nfs"))
+	status, err := ProcedureV1.Execute(context.TODO(), request, client, scheme.Scheme)
+	// An unknown driver doesn't stop the rest of the cluster from being
+	// reconciled
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "unknown drivers: gluster-nfs (available: gluster-block, gluster-fuse)"
+	for _, ar := range status.Results {
+		switch {
+		case ar.Name == driversValid.Name:
+			if ar.Status != corev1.ConditionFalse || ar.Message != want {
+				t.Errorf("expected %s to report %q; got %+v", ar.Name, want, ar)
+			}
+		case ar.Blocked:
+			t.Errorf("expected %s to run; got %+v", ar.Name, ar)
+		}
+	}
+}
+
+func TestInvalidDriverConfigOnlyBlocksTheDriver(t *testing.T) {
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "name",
+			Namespace: "namespace",
+		},
+	}
+	defer func(r driverRegistry) { registry = r }(registry)
+	registry = newDriverRegistry([]Driver{
+		&csiDriver{
+			name:    fuseDriver,
+			actions: glusterFuseDriver.Actions(),
+			validate: func(cluster *operatorv1alpha1.GlusterCluster) error {
+				return fmt.Errorf("no volumes")
+			},
+		},
+		glusterBlockDriver,
+	})
+	client := fake.NewFakeClient(newCluster(request, fuseDriver, blockDriver))
+	status, err := ProcedureV1.Execute(context.TODO(), request, client, scheme.Scheme)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	blocked := make(map[string]bool)
+	for _, a := range glusterFuseDriver.Actions() {
+		blocked[a.Name] = a != glusterFuseConfigValid
+	}
+	for _, ar := range status.Results {
+		switch {
+		case ar.Name == glusterFuseConfigValid.Name:
+			want := "invalid config for driver gluster-fuse: no volumes"
+			if ar.Status != corev1.ConditionFalse || ar.Message != want {
+				t.Errorf("expected %s to report %q; got %+v", ar.Name, want, ar)
+			}
+		case ar.Blocked != blocked[ar.Name]:
+			t.Errorf("expected %s to be blocked: %v; got %+v", ar.Name, blocked[ar.Name], ar)
+		}
+	}
+}
+
+func TestPlanChecksTheSpec(t *testing.T) {
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "name",
+			Namespace: "namespace",
+		},
+	}
+	var tests = []struct {
+		drivers     []string
+		wantInvalid bool
+	}{
+		{[]string{fuseDriver}, false},
+		{[]string{fuseDriver, "gluster-nfs"}, true},
+	}
+	for _, tt := range tests {
+		client := fake.NewFakeClient(newCluster(request, tt.drivers...))
+		changes, err := ProcedureV1.Plan(context.TODO(), request, client, scheme.Scheme)
+		if err != nil {
+			t.Errorf("drivers %v: unexpected error: %v", tt.drivers, err)
+		}
+		planned := make(map[string]bool)
+		for _, c := range changes {
+			planned[c.Action] = true
+		}
+		// The read-only actions are evaluated, rather than assumed to
+		// change something
+		if planned[etcdCRDExists.Name] || planned[driversValid.Name] != tt.wantInvalid {
+			t.Errorf("drivers %v: unexpected plan %v", tt.drivers, changes)
+		}
+	}
+}
+
+func TestDriverNamesAreUnique(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering a driver twice should panic")
+		}
+	}()
+	newDriverRegistry([]Driver{glusterFuseDriver, &csiDriver{name: fuseDriver}})
+}
+
+// newCluster returns a GlusterCluster for the request w/ the given drivers
+func newCluster(request reconcile.Request, drivers ...string) *operatorv1alpha1.GlusterCluster {
+	return &operatorv1alpha1.GlusterCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      request.Name,
+			Namespace: request.Namespace,
+		},
+		Spec: operatorv1alpha1.GlusterClusterSpec{
+			Drivers: drivers,
+		},
+	}
+}
+
+func init() {
+	// The fake client uses the client-go scheme
+	if err := operatorv1alpha1.SchemeBuilder.AddToScheme(scheme.Scheme); err != nil {
+		panic(err)
+	}
+}
@@ -1,6 +1,9 @@
 package glusternode
 
 import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -11,6 +14,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	operatorv1alpha1 "github.com/gluster/anthill/pkg/apis/operator/v1alpha1"
+	"github.com/gluster/anthill/pkg/reconciler"
 )
 
 /**
@@ -21,12 +25,26 @@ import (
 // Add creates a new GlusterNode Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager) error {
-	return add(mgr, newReconciler(mgr))
+	// Actions in flight are cancelled when the manager is told to stop
+	stop := reconciler.NewStopContext()
+	if err := mgr.Add(stop); err != nil {
+		return err
+	}
+	// Metrics are labelled w/ the kind of CR being reconciled
+	ctx := reconciler.WithKind(stop.Context(), "GlusterNode")
+	return add(mgr, newReconciler(ctx, mgr))
 }
 
 // newReconciler returns a new reconcile.Reconciler
-func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileGlusterNode{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+func newReconciler(ctx context.Context, mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileGlusterNode{
+		client:  mgr.GetClient(),
+		scheme:  mgr.GetScheme(),
+		ctx:     ctx,
+		backoff: reconciler.NewBackoff(),
+		events:  reconciler.NewEventRecorder(mgr.GetRecorder("glusternode-controller")),
+		budget:  reconciler.NewDisruptionBudget(disruptionsPerZone),
+	}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
@@ -49,6 +67,16 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		IsController: true,
 		OwnerType:    &operatorv1alpha1.GlusterNode{},
 	})
+	if err != nil {
+		return err
+	}
+
+	// Watch the StatefulSets ensured by the procedure, so their rollouts
+	// are noticed
+	err = c.Watch(&source.Kind{Type: &appsv1.StatefulSet{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &operatorv1alpha1.GlusterNode{},
+	})
 	return err
 }
 
@@ -60,4 +88,13 @@ type ReconcileGlusterNode struct {
 	// that reads objects from the cache and writes to the apiserver
 	client client.Client
 	scheme *runtime.Scheme
+	// ctx is cancelled when the operator is shutting down
+	ctx context.Context
+	// backoff determines when to requeue each CR
+	backoff *reconciler.Backoff
+	// events reports changes in the actions' results as Events on the CR
+	events *reconciler.EventRecorder
+	// budget limits the disruptions of all the GlusterNodes, per zone of
+	// their cluster
+	budget *reconciler.DisruptionBudget
 }
@@ -1,15 +1,21 @@
 package glusternode
 
 import (
+	"context"
+	"fmt"
+
+	operatorv1alpha1 "github.com/gluster/anthill/pkg/apis/operator/v1alpha1"
 	"github.com/gluster/anthill/pkg/reconciler"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 // ProcedureV1 is Procedure version 1
-var ProcedureV1 = reconciler.NewProcedure(
+var ProcedureV1 = reconciler.MustNewProcedure(
 	0,
 	0,
 	[]*reconciler.Action{
@@ -18,17 +24,73 @@ var ProcedureV1 = reconciler.NewProcedure(
 	},
 )
 
+// disruptionsPerZone is the number of pods that may be restarted at a time
+// in each zone of a cluster (see nodeZone)
+const disruptionsPerZone = 1
+
+// nodeZone is the zone of the GlusterNode, qualified by its cluster
+func nodeZone(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (string, error) {
+	node := &operatorv1alpha1.GlusterNode{}
+	if err := client.Get(ctx, request.NamespacedName, node); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v/%v", node.Spec.Cluster, node.Spec.Zone), nil
+}
+
 var etcdEndpointValid = reconciler.NewAction(
 	"etcdEndpointValid",
 	[]*reconciler.Action{},
-	func(request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
+	func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
 		return reconciler.Result{Status: corev1.ConditionTrue, Message: "it's true"}, nil
 	},
+	reconciler.ReadOnly(),
 )
-var statefullSetCreated = reconciler.NewAction(
+
+// glusterd2Image is the image of the Gluster pods
+const glusterd2Image = "docker.io/gluster/glusterd2-nightly:latest"
+
+var statefullSetCreated = reconciler.EnsureObject(
 	"statefullSetCreated",
 	[]*reconciler.Action{etcdEndpointValid},
-	func(request reconcile.Request, client client.Client, scheme *runtime.Scheme) (reconciler.Result, error) {
-		return reconciler.Result{Status: corev1.ConditionTrue, Message: "it's true"}, nil
+	func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (runtime.Object, metav1.Object, error) {
+		node := &operatorv1alpha1.GlusterNode{}
+		if err := client.Get(ctx, request.NamespacedName, node); err != nil {
+			return nil, nil, err
+		}
+		labels := map[string]string{
+			"app.kubernetes.io/part-of":   fmt.Sprintf("glustercluster/%v", node.Spec.Cluster),
+			"app.kubernetes.io/component": "glusterfs",
+			"app.kubernetes.io/name":      "glusterd2",
+			"app.kubernetes.io/instance":  node.Name,
+		}
+		replicas := int32(1)
+		statefulSet := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("gluster-%v", node.Name),
+				Namespace: node.Namespace,
+				Labels:    labels,
+			},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas:    &replicas,
+				ServiceName: fmt.Sprintf("gluster-%v", node.Name),
+				Selector:    &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: labels},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{
+							Name:  "glusterd2",
+							Image: glusterd2Image,
+						}},
+					},
+				},
+			},
+		}
+		if node.Spec.Affinity != nil {
+			statefulSet.Spec.Template.Spec.Affinity = &corev1.Affinity{NodeAffinity: node.Spec.Affinity}
+		}
+		return statefulSet, node, nil
 	},
+	// Limited by the budget shared by all the GlusterNodes (see
+	// disruptionsPerZone)
+	reconciler.Disruptive(nodeZone),
 )
@@ -0,0 +1,162 @@
+package glusternode
+
+import (
+	"context"
+	"testing"
+
+	operatorv1alpha1 "github.com/gluster/anthill/pkg/apis/operator/v1alpha1"
+	"github.com/gluster/anthill/pkg/reconciler"
+	"github.com/gluster/anthill/pkg/reconciler/reconcilertest"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestProceduresAreValid(t *testing.T) {
+	reconcilertest.CheckProcedures(t, allProcedures)
+}
+
+func TestProcedureDiagramsAreCurrent(t *testing.T) {
+	p, err := allProcedures.Newest()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reconcilertest.CheckDiagrams(t, p, "GlusterNode", "../../../docs/Developers/Design/glusternode_procedure")
+}
+
+func TestProceduresDoNotDependOnOrder(t *testing.T) {
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "name",
+			Namespace: "namespace",
+		},
+	}
+	newClient := func() client.Client {
+		return fake.NewFakeClient(&operatorv1alpha1.GlusterNode{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      request.Name,
+				Namespace: request.Namespace,
+			},
+			Spec: operatorv1alpha1.GlusterNodeSpec{
+				Zone: "zone-1",
+			},
+		})
+	}
+	for i := range allProcedures {
+		reconcilertest.CheckAllOrders(t, &allProcedures[i], request, newClient, scheme.Scheme)
+	}
+}
+
+func TestPlanChecksTheNode(t *testing.T) {
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "name", Namespace: "namespace"}}
+	client := fake.NewFakeClient(&operatorv1alpha1.GlusterNode{
+		ObjectMeta: metav1.ObjectMeta{Name: request.Name, Namespace: request.Namespace},
+	})
+	changes, err := ProcedureV1.Plan(context.TODO(), request, client, scheme.Scheme)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The read-only actions are evaluated, rather than assumed to change
+	// something
+	want := reconciler.PlannedChange{Action: statefullSetCreated.Name, Message: "StatefulSet namespace/gluster-name would be created"}
+	if len(changes) != 1 || changes[0] != want {
+		t.Errorf("expected %v; got %v", want, changes)
+	}
+}
+
+func TestNodesInAZoneRestartOneAtATime(t *testing.T) {
+	node := func(name, zone string) *operatorv1alpha1.GlusterNode {
+		return &operatorv1alpha1.GlusterNode{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "namespace"},
+			Spec:       operatorv1alpha1.GlusterNodeSpec{Cluster: "cluster", Zone: zone},
+		}
+	}
+	client := fake.NewFakeClient(node("node-1", "zone-1"), node("node-2", "zone-1"), node("node-3", "zone-2"))
+	ctx := reconciler.WithDisruptionBudget(context.TODO(), reconciler.NewDisruptionBudget(disruptionsPerZone))
+	setReady := func(name string, ready int32) {
+		ss := &appsv1.StatefulSet{}
+		key := types.NamespacedName{Name: "gluster-" + name, Namespace: "namespace"}
+		if err := client.Get(ctx, key, ss); err != nil {
+			t.Fatalf("unable to get the StatefulSet of %s: %v", name, err)
+		}
+		ss.Status.ReadyReplicas = ready
+		if err := client.Status().Update(ctx, ss); err != nil {
+			t.Fatalf("unable to update the StatefulSet of %s: %v", name, err)
+		}
+	}
+	// change changes the affinity of the node, which updates the template
+	// of its StatefulSet
+	change := func(name string) {
+		node := &operatorv1alpha1.GlusterNode{}
+		if err := client.Get(ctx, types.NamespacedName{Name: name, Namespace: "namespace"}, node); err != nil {
+			t.Fatalf("unable to get %s: %v", name, err)
+		}
+		node.Spec.Affinity = &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{{
+						Key:      "kubernetes.io/hostname",
+						Operator: corev1.NodeSelectorOpIn,
+						Values:   []string{name},
+					}},
+				}},
+			},
+		}
+		if err := client.Update(ctx, node); err != nil {
+			t.Fatalf("unable to update %s: %v", name, err)
+		}
+	}
+
+	// Creating the StatefulSets doesn't use the budget, updating them does
+	var steps = []struct {
+		node       string
+		ready      bool
+		restarting bool
+		changed    bool
+		want       string
+	}{
+		{"node-1", false, false, false, "created StatefulSet namespace/gluster-node-1"},
+		{"node-2", false, false, false, "created StatefulSet namespace/gluster-node-2"},
+		{"node-3", false, false, false, "created StatefulSet namespace/gluster-node-3"},
+		{"node-1", true, false, true, "updated StatefulSet namespace/gluster-node-1"},
+		{"node-2", true, false, true, "waiting for disruption budget in zone cluster/zone-1"},
+		{"node-3", true, false, true, "updated StatefulSet namespace/gluster-node-3"},
+		{"node-1", false, true, false, "waiting for rollout of StatefulSet namespace/gluster-node-1: 0 of 1 replicas ready"},
+		{"node-2", false, false, false, "waiting for disruption budget in zone cluster/zone-1"},
+		{"node-1", true, false, false, "StatefulSet namespace/gluster-node-1 is rolled out"},
+		{"node-2", false, false, false, "updated StatefulSet namespace/gluster-node-2"},
+	}
+	for i, step := range steps {
+		switch {
+		case step.ready:
+			setReady(step.node, 1)
+		case step.restarting:
+			setReady(step.node, 0)
+		}
+		if step.changed {
+			change(step.node)
+		}
+		request := reconcile.Request{NamespacedName: types.NamespacedName{Name: step.node, Namespace: "namespace"}}
+		status, err := ProcedureV1.Execute(ctx, request, client, scheme.Scheme)
+		if err != nil {
+			t.Fatalf("step %d: unexpected error: %v", i, err)
+		}
+		for _, ar := range status.Results {
+			if ar.Name == statefullSetCreated.Name && ar.Message != step.want {
+				t.Errorf("step %d: expected %s to report %q; got %+v", i, step.node, step.want, ar.Result)
+			}
+		}
+	}
+}
+
+func init() {
+	// The fake client uses the client-go scheme
+	if err := operatorv1alpha1.SchemeBuilder.AddToScheme(scheme.Scheme); err != nil {
+		panic(err)
+	}
+}
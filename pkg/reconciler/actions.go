@@ -1,7 +1,9 @@
 package reconciler
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -9,6 +11,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+// DefaultActionTimeout is the amount of time an Action is permitted to run
+// if no timeout was specified when it was created.
+const DefaultActionTimeout = 30 * time.Second
+
 // Result is the result of a Action
 type Result struct {
 	// Status describes the outcome of the action. If True, the action found
@@ -17,63 +23,301 @@ type Result struct {
 	Status corev1.ConditionStatus
 	// Message is a short human-readable explanation of the result
 	Message string
+	// RequeueAfter, if non-zero, is a hint of how long to wait before the
+	// state should be checked again (e.g., "pods are starting, check in
+	// 5s").
+	RequeueAfter time.Duration `json:"-"`
+	// Skipped is true if the action was not applicable to the CR (see
+	// When). Skipped actions have Status True so that their dependents
+	// treat them as satisfied, but are reported as skipped.
+	Skipped bool `json:"-"`
+	// NonDisruptive is set by a check (see WithCheck) that found changes
+	// to be needed, but that they don't disrupt the system (e.g., an
+	// object would be created), so that a Disruptive action applies them
+	// w/o using the disruption budget.
+	NonDisruptive bool `json:"-"`
 }
 
+// ActionFunc is the function that performs the work of an Action. The
+// context will be cancelled once the Action's timeout expires or the
+// operator is shutting down, so all blocking calls should honor it.
+type ActionFunc func(context.Context, reconcile.Request, client.Client, *runtime.Scheme) (Result, error)
+
+// Predicate determines whether an Action applies to the CR being reconciled
+// (e.g., whether a feature is enabled in its spec). It must not change the
+// system state.
+type Predicate func(context.Context, reconcile.Request, client.Client, *runtime.Scheme) (bool, error)
+
 // Action is an action that reconciles the system state. It has a list
 // of prerequisite actions that must be true in order for the action to be
-// invoked.
+// invoked. An Action holds no state of its own once created, so the same
+// Action may be executed concurrently on behalf of different requests.
 type Action struct {
 	// Name is a name for the Action, to be used in the CR status and log
 	// messages
 	Name string
-	// prereqs are the (ordered) list of prerequisites that must be true
-	// prior to attempting the reconcile action
+	// prereqs are the list of prerequisites that must be true prior to
+	// attempting the reconcile action
 	prereqs []*Action
+	// predicates must all hold for the action to apply to a CR
+	predicates []Predicate
+	// check, if set, determines without making changes whether action
+	// needs to be applied
+	check ActionFunc
+	// readOnly is true if action makes no changes, so it can be planned
+	readOnly bool
 	// action attempts to perform the actual reconcile
-	action func(reconcile.Request, client.Client, *runtime.Scheme) (Result, error)
-	// lastResult holds the result of the last execution of action() or nil
-	lastResult *Result
-	// lastError holds the error of the last execution of action() or nil
-	lastError error
+	action ActionFunc
+	// cleanup, if set, removes what action created when tearing down
+	cleanup ActionFunc
+	// timeout is the maximum amount of time action is allowed to run
+	timeout time.Duration
+	// produces are the Values that action publishes
+	produces []*Value
+	// consumes are the Values that action reads
+	consumes []*Value
+	// disruptive is true if applying a change disrupts the system, in
+	// zone if set (see Disruptive)
+	disruptive bool
+	zone       ZoneFunc
+	// group is true if the Action is a group of Actions (its prereqs),
+	// whose Result is the aggregate of theirs (see NewGroup)
+	group bool
+}
+
+// phase is the part of an Action's lifecycle being run
+type phase int
+
+const (
+	// applyPhase checks the system and, if needed, changes it
+	applyPhase phase = iota
+	// planPhase only checks the system
+	planPhase
+	// cleanupPhase removes what the Action created
+	cleanupPhase
+)
+
+func (p phase) String() string {
+	switch p {
+	case planPhase:
+		return "plan"
+	case cleanupPhase:
+		return "cleanup"
+	}
+	return "apply"
 }
 
-//NewAction is a constructor for Action.
-func NewAction(Name string, prereqs []*Action, action func(reconcile.Request, client.Client, *runtime.Scheme) (Result, error)) *Action {
-	return &Action{
+// ActionOption is used to set optional parameters of an Action when it is
+// created by NewAction.
+type ActionOption func(*Action)
+
+// WithTimeout sets the maximum amount of time the Action may run before it
+// is abandoned and reported as corev1.ConditionUnknown.
+func WithTimeout(timeout time.Duration) ActionOption {
+	return func(a *Action) {
+		a.timeout = timeout
+	}
+}
+
+// WithCheck sets a read-only check for the Action. The check returns
+// corev1.ConditionTrue if the system state is already reconciled, in which
+// case the Action's function is not invoked. Otherwise, its Result describes
+// the change that the Action's function would make. Checks are also used to
+// plan a Procedure without modifying the system. The check and the Action's
+// function share the Action's timeout.
+func WithCheck(check ActionFunc) ActionOption {
+	return func(a *Action) {
+		a.check = check
+	}
+}
+
+// ReadOnly marks the Action as only reading the system state (e.g.,
+// validating the spec of the CR), so that its function is also used to plan
+// a Procedure. Such an Action needs no check.
+func ReadOnly() ActionOption {
+	return func(a *Action) {
+		a.readOnly = true
+	}
+}
+
+// When adds a predicate that must hold for the Action to apply to a CR. If
+// any predicate doesn't, the Action is skipped when applying or planning:
+// its function and check are not invoked, and it is reported as Skipped.
+// When applying, its cleanup is run instead, since what the Action created
+// must be removed once it no longer applies, and the Action is only Skipped
+// once the cleanup is True. Teardown runs cleanups regardless. Predicates
+// share the Action's timeout.
+func When(predicate Predicate) ActionOption {
+	return func(a *Action) {
+		a.predicates = append(a.predicates, predicate)
+	}
+}
+
+// WithCleanup sets the function that removes what the Action created when
+// the Procedure is torn down. The cleanup returns corev1.ConditionTrue once
+// everything has been removed. It shares the Action's timeout.
+func WithCleanup(cleanup ActionFunc) ActionOption {
+	return func(a *Action) {
+		a.cleanup = cleanup
+	}
+}
+
+// NewAction is a constructor for Action.
+func NewAction(Name string, prereqs []*Action, action ActionFunc, options ...ActionOption) *Action {
+	a := &Action{
 		Name:    Name,
 		prereqs: prereqs,
 		action:  action,
+		timeout: DefaultActionTimeout,
+	}
+	for _, option := range options {
+		option(a)
 	}
+	return a
 }
 
-// Execute or return a previously cached result of the Action, checking prereqs first
-func (ra *Action) Execute(request reconcile.Request, client client.Client, scheme *runtime.Scheme) (Result, error) {
-	// If we have executed before, return the cached result
-	if ra.lastResult != nil {
-		return *ra.lastResult, ra.lastError
+// Timeout is the maximum amount of time the Action is allowed to run
+func (ra *Action) Timeout() time.Duration {
+	if ra.timeout <= 0 {
+		return DefaultActionTimeout
 	}
+	return ra.timeout
+}
 
-	// Walk through the prereqs; stop and return corev1.ConditionUnknown if a prereq doesn't return corev1.ConditionTrue
-	for _, prereq := range ra.prereqs {
-		result, err := prereq.Execute(request, client, scheme)
-		if err != nil || result.Status != corev1.ConditionTrue {
-			ra.lastResult = &Result{
+// Execute the Action, checking prereqs first. Each call is independent; the
+// Action and its prereqs are executed at most once per call.
+func (ra *Action) Execute(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (Result, error) {
+	run := newExecution(ctx, request, client, scheme)
+	run.execute([]*Action{ra}, DefaultWorkers)
+	n := run.completed(ra)
+	if n == nil {
+		// Execution only stops early if we were cancelled
+		return Result{
+			Status:  corev1.ConditionUnknown,
+			Message: "action was cancelled",
+		}, ctx.Err()
+	}
+	return n.result, n.err
+}
+
+// run invokes the given phase of the action, abandoning it if it does not
+// complete before its timeout expires or ctx is cancelled.
+func (ra *Action) run(ctx context.Context, phase phase, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{
+			Status:  corev1.ConditionUnknown,
+			Message: "action was cancelled",
+		}, err
+	}
+
+	actionCtx, cancel := context.WithTimeout(ctx, ra.Timeout())
+	defer cancel()
+
+	type outcome struct {
+		result Result
+		err    error
+	}
+	// The channel is buffered so that an abandoned action can still
+	// complete (and be garbage collected) after we have stopped waiting
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := ra.invoke(actionCtx, phase, request, client, scheme)
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-actionCtx.Done():
+		if err := ctx.Err(); err != nil {
+			// The caller is no longer interested in the result
+			return Result{
 				Status:  corev1.ConditionUnknown,
-				Message: fmt.Sprintf("prequisite %s not met", prereq.Name),
-			}
-			ra.lastError = nil
-			return *ra.lastResult, ra.lastError
+				Message: "action was cancelled",
+			}, err
+		}
+		return Result{
+			Status:  corev1.ConditionUnknown,
+			Message: fmt.Sprintf("action timed out after %v", ra.Timeout()),
+		}, nil
+	}
+}
+
+// invoke runs the functions of the action for the phase. When applying, the
+// predicates and then the check, if any, run first and the action's function
+// only runs if the action applies, the check found that changes are needed
+// and, for disruptive actions, the disruption budget allows. An action that
+// doesn't apply is cleaned up instead (see skip). A disruptive action that is
+// True, or fails, no longer holds any budget.
+func (ra *Action) invoke(ctx context.Context, phase phase, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (Result, error) {
+	switch phase {
+	case cleanupPhase:
+		if ra.cleanup == nil {
+			return Result{
+				Status:  corev1.ConditionTrue,
+				Message: "nothing to clean up",
+			}, nil
 		}
+		return ra.cleanup(ctx, request, client, scheme)
+	case planPhase:
+		return ra.reconcile(ctx, true, request, client, scheme)
 	}
+	result, err := ra.reconcile(ctx, false, request, client, scheme)
+	ra.endDisruption(ctx, request, result, err)
+	return result, err
+}
 
-	// Perform the reconcile action
-	result, err := ra.action(request, client, scheme)
-	ra.lastResult, ra.lastError = &result, err
-	return *ra.lastResult, ra.lastError
+// skip reports that the action doesn't apply. Unless planning, its cleanup
+// runs first, since the action may have applied before the CR changed, and
+// the action is only skipped once the cleanup is True.
+func (ra *Action) skip(ctx context.Context, plan bool, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (Result, error) {
+	if !plan && ra.cleanup != nil {
+		result, err := ra.cleanup(ctx, request, client, scheme)
+		if err != nil || result.Status != corev1.ConditionTrue {
+			if err != nil {
+				result.Status = corev1.ConditionUnknown
+			}
+			result.Message = fmt.Sprintf("action does not apply, cleaning up: %s", result.Message)
+			return result, err
+		}
+	}
+	return Result{
+		Status:  corev1.ConditionTrue,
+		Message: "action does not apply",
+		Skipped: true,
+	}, nil
 }
 
-// Clear and cached results of this Action
-func (ra *Action) Clear() {
-	ra.lastResult = nil
-	ra.lastError = nil
+// reconcile runs the predicates, check and, unless planning, function of the
+// action
+func (ra *Action) reconcile(ctx context.Context, plan bool, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (Result, error) {
+	for _, predicate := range ra.predicates {
+		applies, err := predicate(ctx, request, client, scheme)
+		if err != nil {
+			return Result{
+				Status:  corev1.ConditionUnknown,
+				Message: fmt.Sprintf("unable to evaluate predicate: %v", err),
+			}, err
+		}
+		if !applies {
+			return ra.skip(ctx, plan, request, client, scheme)
+		}
+	}
+	var checked Result
+	if ra.check != nil {
+		result, err := ra.check(ctx, request, client, scheme)
+		if plan || err != nil || result.Status == corev1.ConditionTrue {
+			return result, err
+		}
+		checked = result
+	} else if plan && !ra.readOnly {
+		return Result{
+			Status:  corev1.ConditionUnknown,
+			Message: "action has no check, so it would be applied",
+		}, nil
+	}
+	if result, ok, err := ra.takeBudget(ctx, checked, request, client, scheme); !ok {
+		return result, err
+	}
+	return ra.action(ctx, request, client, scheme)
 }
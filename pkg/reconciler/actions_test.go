@@ -1,8 +1,11 @@
 package reconciler
 
 import (
+	"context"
 	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -14,21 +17,21 @@ import (
 
 var trueAction = Action{
 	Name: "trueAction",
-	action: func(_ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+	action: func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
 		return Result{Status: corev1.ConditionTrue, Message: "it's true"}, nil
 	},
 }
 
 var falseAction = Action{
 	Name: "falseAction",
-	action: func(_ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+	action: func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
 		return Result{Status: corev1.ConditionFalse, Message: "it's false"}, nil
 	},
 }
 
 var unknownAction = Action{
 	Name: "unknownAction",
-	action: func(_ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+	action: func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
 		return Result{Status: corev1.ConditionUnknown, Message: "who knows?"}, nil
 	},
 }
@@ -36,7 +39,7 @@ var unknownAction = Action{
 var errGeneric = errors.New("an error")
 var errorAction = Action{
 	Name: "errorAction",
-	action: func(_ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+	action: func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
 		return Result{Status: corev1.ConditionUnknown, Message: "it was bad"}, errGeneric
 	},
 }
@@ -44,7 +47,7 @@ var errorAction = Action{
 var tfAction = Action{
 	Name:    "TruePrereqsFalseAction",
 	prereqs: []*Action{&trueAction, &trueAction},
-	action: func(_ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+	action: func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
 		return Result{Status: corev1.ConditionFalse, Message: "it's false"}, nil
 	},
 }
@@ -52,15 +55,21 @@ var tfAction = Action{
 var ftAction = Action{
 	Name:    "FalsePrereqsTrueAction",
 	prereqs: []*Action{&trueAction, &falseAction},
-	action: func(_ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+	action: func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
 		return Result{Status: corev1.ConditionTrue, Message: "it's true"}, nil
 	},
 }
 
+var ttAction = Action{
+	Name:    "CountPrereqTrueAction",
+	prereqs: []*Action{&countAction},
+	action:  trueAction.action,
+}
+
 var count int
 var countAction = Action{
 	Name: "CountingAction",
-	action: func(_ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+	action: func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
 		count++
 		return Result{Status: corev1.ConditionTrue, Message: "it's true"}, nil
 	},
@@ -90,14 +99,14 @@ func TestActionsReturnCorrectValue(t *testing.T) {
 	var scheme *runtime.Scheme
 
 	for _, test := range tests {
-		r, e := test.input.Execute(request, client, scheme)
+		r, e := test.input.Execute(context.TODO(), request, client, scheme)
 		if r.Status != test.wantCond || e != test.wantErr {
 			t.Errorf("%s -- expected: (%v, %v) -- got: (%v, %v)", test.input.Name, test.wantCond, test.wantErr, r.Status, e)
 		}
 	}
 }
 
-func TestActionsCacheValues(t *testing.T) {
+func TestActionsCacheValuesPerExecution(t *testing.T) {
 	request := reconcile.Request{
 		NamespacedName: types.NamespacedName{
 			Name:      "name",
@@ -107,18 +116,176 @@ func TestActionsCacheValues(t *testing.T) {
 	client := fake.NewFakeClient()
 	var scheme *runtime.Scheme
 
+	// countAction is reachable via multiple paths, but should only be
+	// executed once per call to Execute()
+	a := Action{
+		Name:    "DiamondAction",
+		prereqs: []*Action{&countAction, &ttAction},
+		action:  trueAction.action,
+	}
+
 	count = 0
-	countAction.Execute(request, client, scheme)
+	a.Execute(context.TODO(), request, client, scheme)
 	if count != 1 {
 		t.Errorf("execution count should be 1; is %d", count)
 	}
-	countAction.Execute(request, client, scheme)
-	if count != 1 {
-		t.Errorf("execution was not properly cached")
-	}
-	countAction.Clear()
-	countAction.Execute(request, client, scheme)
+	a.Execute(context.TODO(), request, client, scheme)
 	if count != 2 {
-		t.Errorf("execution count should be 2; cache didn't clear")
+		t.Errorf("execution count should be 2; cached value leaked between executions")
+	}
+}
+
+func TestActionTimesOut(t *testing.T) {
+	// hung never returns on its own; it only gives up when its context
+	// is cancelled.
+	hung := NewAction("hungAction", []*Action{},
+		func(ctx context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+			<-ctx.Done()
+			return Result{Status: corev1.ConditionTrue, Message: "too late"}, nil
+		},
+		WithTimeout(10*time.Millisecond))
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "name",
+			Namespace: "namespace",
+		},
+	}
+	client := fake.NewFakeClient()
+	var scheme *runtime.Scheme
+
+	r, err := hung.Execute(context.TODO(), request, client, scheme)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if r.Status != corev1.ConditionUnknown {
+		t.Errorf("timed out action should be %v; got: %v", corev1.ConditionUnknown, r.Status)
+	}
+	if !strings.Contains(r.Message, "timed out") {
+		t.Errorf("message should say the action timed out; got: %q", r.Message)
+	}
+}
+
+func TestActionIsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	blocked := NewAction("blockedAction", []*Action{},
+		func(ctx context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+			close(started)
+			<-ctx.Done()
+			return Result{Status: corev1.ConditionTrue, Message: "too late"}, nil
+		})
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "name",
+			Namespace: "namespace",
+		},
+	}
+	client := fake.NewFakeClient()
+	var scheme *runtime.Scheme
+
+	go func() {
+		<-started
+		cancel()
+	}()
+	r, err := blocked.Execute(ctx, request, client, scheme)
+	if err != context.Canceled {
+		t.Errorf("expected error %v; got: %v", context.Canceled, err)
+	}
+	if r.Status != corev1.ConditionUnknown {
+		t.Errorf("cancelled action should be %v; got: %v", corev1.ConditionUnknown, r.Status)
+	}
+}
+
+func TestSkippedActionsAreCleanedUp(t *testing.T) {
+	never := func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (bool, error) {
+		return false, nil
+	}
+	// The cleanup takes two executions to remove what the action created
+	cleanups := 0
+	cleanup := func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+		cleanups++
+		if cleanups < 2 {
+			return Result{Status: corev1.ConditionUnknown, Message: "deleting"}, nil
+		}
+		return Result{Status: corev1.ConditionTrue, Message: "gone"}, nil
+	}
+	a := NewAction("conditional", []*Action{}, falseAction.action, When(never), WithCleanup(cleanup))
+	p := MustNewProcedure(0, 0, []*Action{a})
+
+	var tests = []Result{
+		{Status: corev1.ConditionUnknown, Message: "action does not apply, cleaning up: deleting"},
+		{Status: corev1.ConditionTrue, Message: "action does not apply", Skipped: true},
+	}
+	for i, want := range tests {
+		status, err := p.Execute(context.TODO(), reconcile.Request{}, fake.NewFakeClient(), nil)
+		if err != nil {
+			t.Fatalf("execution %d: unexpected error: %v", i, err)
+		}
+		if got := status.Results[0].Result; got != want {
+			t.Errorf("execution %d: expected %+v; got %+v", i, want, got)
+		}
+	}
+	// Planning doesn't clean up
+	if _, err := p.Plan(context.TODO(), reconcile.Request{}, fake.NewFakeClient(), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cleanups != 2 {
+		t.Errorf("expected the cleanup to run twice; got %d", cleanups)
+	}
+}
+
+func TestActionPredicates(t *testing.T) {
+	always := func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (bool, error) {
+		return true, nil
+	}
+	never := func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (bool, error) {
+		return false, nil
+	}
+	failing := func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (bool, error) {
+		return false, errGeneric
+	}
+
+	var tests = []struct {
+		name        string
+		predicates  []Predicate
+		wantCond    corev1.ConditionStatus
+		wantSkipped bool
+		wantErr     error
+	}{
+		{"no predicates", nil, corev1.ConditionFalse, false, nil},
+		{"applies", []Predicate{always}, corev1.ConditionFalse, false, nil},
+		{"does not apply", []Predicate{always, never}, corev1.ConditionTrue, true, nil},
+		{"predicate fails", []Predicate{failing}, corev1.ConditionUnknown, false, errGeneric},
+	}
+	for _, tt := range tests {
+		var options []ActionOption
+		for _, predicate := range tt.predicates {
+			options = append(options, When(predicate))
+		}
+		// Dependents of a skipped action treat it as satisfied
+		a := NewAction("conditional", []*Action{}, falseAction.action, options...)
+		dependent := NewAction("dependent", []*Action{a}, trueAction.action)
+		p := MustNewProcedure(0, 0, []*Action{a, dependent})
+		client := fake.NewFakeClient()
+		status, err := p.Execute(context.TODO(), reconcile.Request{}, client, nil)
+		if (err == nil) != (tt.wantErr == nil) {
+			t.Errorf("%s: expected error %v; got %v", tt.name, tt.wantErr, err)
+		}
+		got := status.Results[0]
+		if got.Status != tt.wantCond || got.Skipped != tt.wantSkipped {
+			t.Errorf("%s: expected %v (skipped: %v); got %+v", tt.name, tt.wantCond, tt.wantSkipped, got)
+		}
+		wantDependent := corev1.ConditionUnknown
+		if tt.wantSkipped {
+			wantDependent = corev1.ConditionTrue
+		}
+		if status.Results[1].Status != wantDependent {
+			t.Errorf("%s: expected dependent to be %v; got %+v", tt.name, wantDependent, status.Results[1])
+		}
+		if status.FullyReconciled != tt.wantSkipped {
+			t.Errorf("%s: unexpected FullyReconciled %v", tt.name, status.FullyReconciled)
+		}
 	}
 }
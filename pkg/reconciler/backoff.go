@@ -0,0 +1,128 @@
+package reconciler
+
+import (
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// DefaultBackoffBase is the delay after an action's first failure, or
+	// while it is pending, if the action did not suggest one
+	DefaultBackoffBase = 2 * time.Second
+	// DefaultBackoffMax is the longest delay due to repeated failures
+	DefaultBackoffMax = 5 * time.Minute
+	// DefaultResyncInterval is how often a fully reconciled CR is checked
+	DefaultResyncInterval = 30 * time.Second
+)
+
+// Backoff determines when a CR should next be reconciled, based on the
+// results of executing its Procedure. Each time an action fails for a CR
+// (i.e., returns an error, even a transient one, or is False), the delay
+// before that CR is checked again doubles (starting from the action's own
+// RequeueAfter hint, or Base), until the action no longer fails. Actions
+// that are pending (Unknown w/o an error) are checked again after their hint,
+// or Base, and actions that didn't run because their prereqs were not met
+// don't count: the prereqs that block them set the delay. A single Backoff
+// is shared by all the reconciles of a controller.
+type Backoff struct {
+	// Base is the initial delay for actions that don't provide a hint
+	Base time.Duration
+	// Max is the upper limit of the delay
+	Max time.Duration
+	// ResyncInterval is the delay once the CR is fully reconciled
+	ResyncInterval time.Duration
+
+	// mutex protects failures
+	mutex sync.Mutex
+	// failures is the number of consecutive failures of each action, per
+	// CR
+	failures map[types.NamespacedName]map[string]uint
+}
+
+// NewBackoff is a constructor for Backoff, using the default delays
+func NewBackoff() *Backoff {
+	return &Backoff{
+		Base:           DefaultBackoffBase,
+		Max:            DefaultBackoffMax,
+		ResyncInterval: DefaultResyncInterval,
+		failures:       make(map[types.NamespacedName]map[string]uint),
+	}
+}
+
+// RequeueAfter records the results from a Procedure execution for the named
+// CR and returns how long to wait before reconciling it again.
+func (b *Backoff) RequeueAfter(name types.NamespacedName, status *ProcedureStatus) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	failures, ok := b.failures[name]
+	if !ok {
+		failures = make(map[string]uint)
+		b.failures[name] = failures
+	}
+
+	var delay time.Duration
+	if status.FullyReconciled {
+		delay = b.ResyncInterval
+	}
+	// status.RequeueAfter is the earliest raw hint, which would defeat the
+	// backoff; the members of groups are considered instead of the groups
+	for _, r := range flatten(status.Results) {
+		if r.Members != nil || r.Blocked {
+			continue
+		}
+		switch {
+		case r.Err != nil || r.Transient || r.Status == corev1.ConditionFalse:
+			failures[r.Name]++
+			delay = earliest(delay, b.delay(r.RequeueAfter, failures[r.Name]))
+		case r.Status == corev1.ConditionTrue:
+			delete(failures, r.Name)
+			// Hints of actions that are True are not backed off
+			delay = earliest(delay, r.RequeueAfter)
+		default:
+			delete(failures, r.Name)
+			delay = earliest(delay, b.delay(r.RequeueAfter, 1))
+		}
+	}
+	if len(failures) == 0 {
+		delete(b.failures, name)
+	}
+	return delay
+}
+
+// Forget discards the history of the named CR, e.g., once it is deleted
+func (b *Backoff) Forget(name types.NamespacedName) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.failures, name)
+}
+
+// delay is the backoff for an action that has failed the given number of
+// consecutive times
+func (b *Backoff) delay(hint time.Duration, failures uint) time.Duration {
+	delay := hint
+	if delay <= 0 {
+		delay = b.Base
+	}
+	for i := uint(1); i < failures && delay < b.Max; i++ {
+		delay *= 2
+	}
+	if delay > b.Max {
+		delay = b.Max
+	}
+	return delay
+}
+
+// earliest returns the shorter of the two (non-zero) durations
+func earliest(a, b time.Duration) time.Duration {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 || a < b {
+		return a
+	}
+	return b
+}
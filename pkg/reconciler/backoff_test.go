@@ -0,0 +1,145 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestBackoffDoublesForRepeatedFailures(t *testing.T) {
+	b := NewBackoff()
+	b.Base = time.Second
+	b.Max = 10 * time.Second
+	b.ResyncInterval = 30 * time.Second
+	name := types.NamespacedName{Name: "name", Namespace: "namespace"}
+	stuck := &ProcedureStatus{
+		Results: []ActionResult{
+			{Name: "ok", Result: Result{Status: corev1.ConditionTrue}},
+			{Name: "stuck", Result: Result{Status: corev1.ConditionFalse}},
+		},
+	}
+
+	for _, expected := range []time.Duration{1, 2, 4, 8, 10, 10} {
+		expected *= time.Second
+		if actual := b.RequeueAfter(name, stuck); actual != expected {
+			t.Errorf("expected %v; got %v", expected, actual)
+		}
+	}
+
+	// Once reconciled, the history is reset
+	done := &ProcedureStatus{
+		FullyReconciled: true,
+		Results: []ActionResult{
+			{Name: "ok", Result: Result{Status: corev1.ConditionTrue}},
+			{Name: "stuck", Result: Result{Status: corev1.ConditionTrue}},
+		},
+	}
+	if actual := b.RequeueAfter(name, done); actual != b.ResyncInterval {
+		t.Errorf("expected %v; got %v", b.ResyncInterval, actual)
+	}
+	if actual := b.RequeueAfter(name, stuck); actual != b.Base {
+		t.Errorf("expected %v; got %v", b.Base, actual)
+	}
+}
+
+func TestBackoffUsesHints(t *testing.T) {
+	b := NewBackoff()
+	b.Base = time.Second
+	b.Max = time.Minute
+	name := types.NamespacedName{Name: "name", Namespace: "namespace"}
+	other := types.NamespacedName{Name: "other", Namespace: "namespace"}
+	hint := func(status corev1.ConditionStatus, after time.Duration, err error) ActionFunc {
+		return func(context.Context, reconcile.Request, client.Client, *runtime.Scheme) (Result, error) {
+			return Result{Status: status, RequeueAfter: after}, err
+		}
+	}
+	p := MustNewProcedure(0, 0, []*Action{
+		NewAction("slow", []*Action{}, hint(corev1.ConditionFalse, 5*time.Second, nil)),
+		NewGroup("group", []*Action{
+			NewAction("slower", []*Action{}, hint(corev1.ConditionUnknown, 7*time.Second, Transient(errGeneric))),
+		}),
+	})
+	execute := func() *ProcedureStatus {
+		status, err := p.Execute(context.TODO(), reconcile.Request{NamespacedName: name}, nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return status
+	}
+
+	// Earliest hint wins, then each action backs off from its own hint
+	// (rather than retrying at the hint that Execute reports)
+	for _, expected := range []time.Duration{5, 10, 20, 40, 60, 60} {
+		expected *= time.Second
+		if actual := b.RequeueAfter(name, execute()); actual != expected {
+			t.Errorf("expected %v; got %v", expected, actual)
+		}
+	}
+
+	// Other CRs have their own history
+	if actual := b.RequeueAfter(other, execute()); actual != 5*time.Second {
+		t.Errorf("expected %v; got %v", 5*time.Second, actual)
+	}
+	b.Forget(name)
+	if actual := b.RequeueAfter(name, execute()); actual != 5*time.Second {
+		t.Errorf("expected %v; got %v", 5*time.Second, actual)
+	}
+}
+
+func TestBackoffOnlyCountsFailures(t *testing.T) {
+	b := NewBackoff()
+	b.Base = time.Second
+	b.Max = time.Minute
+	name := types.NamespacedName{Name: "name", Namespace: "namespace"}
+	rootFails := true
+	root := NewAction("root", []*Action{}, func(context.Context, reconcile.Request, client.Client, *runtime.Scheme) (Result, error) {
+		if rootFails {
+			return Result{}, errGeneric
+		}
+		return Result{Status: corev1.ConditionTrue}, nil
+	})
+	dependent := NewAction("dependent", []*Action{root}, falseAction.action)
+	pending := NewAction("pending", []*Action{}, func(context.Context, reconcile.Request, client.Client, *runtime.Scheme) (Result, error) {
+		return Result{Status: corev1.ConditionUnknown, RequeueAfter: 30 * time.Second}, nil
+	})
+	p := MustNewProcedure(0, 0, []*Action{root, dependent, pending})
+	requeueAfter := func() time.Duration {
+		status, _ := p.Execute(context.TODO(), reconcile.Request{NamespacedName: name}, nil, nil)
+		return b.RequeueAfter(name, status)
+	}
+
+	// Only the root backs off while its dependent is blocked, and the
+	// pending action is checked after its hint
+	for _, expected := range []time.Duration{1, 2, 4, 8, 16, 30, 30} {
+		expected *= time.Second
+		if actual := requeueAfter(); actual != expected {
+			t.Errorf("expected %v; got %v", expected, actual)
+		}
+	}
+	// Once it runs, the dependent starts backing off from the beginning
+	rootFails = false
+	if actual := requeueAfter(); actual != b.Base {
+		t.Errorf("expected %v; got %v", b.Base, actual)
+	}
+}
+
+func TestBackoffHintShortensResync(t *testing.T) {
+	b := NewBackoff()
+	name := types.NamespacedName{Name: "name", Namespace: "namespace"}
+	status := &ProcedureStatus{
+		FullyReconciled: true,
+		RequeueAfter:    time.Second,
+		Results: []ActionResult{
+			{Name: "ok", Result: Result{Status: corev1.ConditionTrue, RequeueAfter: time.Second}},
+		},
+	}
+	if actual := b.RequeueAfter(name, status); actual != time.Second {
+		t.Errorf("expected %v; got %v", time.Second, actual)
+	}
+}
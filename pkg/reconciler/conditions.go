@@ -0,0 +1,145 @@
+package reconciler
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Types of the conditions that summarize the state of a CR. The other
+// conditions of a CR are named after the procedure level actions.
+const (
+	// ConditionReady is True when the CR is fully reconciled
+	ConditionReady = "Ready"
+	// ConditionProgressing is True while actions are waiting for the
+	// system to converge (i.e., are Unknown w/o an error)
+	ConditionProgressing = "Progressing"
+	// ConditionDegraded is True when actions are False or failed
+	ConditionDegraded = "Degraded"
+)
+
+// Reasons of the summary conditions, besides those used for Events
+const (
+	// ReasonReconciled is used when all actions are True
+	ReasonReconciled = "Reconciled"
+	// ReasonNotReconciled is used when some actions are not True
+	ReasonNotReconciled = "NotReconciled"
+	// ReasonNoFailures is used when no action is False or failed
+	ReasonNoFailures = "NoFailures"
+)
+
+// Condition is a Kubernetes-style condition, intended to be stored in the
+// status of a CR so that tools such as "kubectl wait" can use it
+type Condition struct {
+	// Type is the name of the condition
+	Type string `json:"type"`
+	// Status is one of True, False or Unknown
+	Status corev1.ConditionStatus `json:"status"`
+	// ObservedGeneration is the generation of the CR the condition was
+	// computed for
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastTransitionTime is when Status last changed
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Reason is a CamelCase explanation of Status
+	Reason string `json:"reason,omitempty"`
+	// Message is a human-readable explanation of Status
+	Message string `json:"message,omitempty"`
+}
+
+// DeepCopyInto copies the receiver into out, for the generated deepcopy
+// functions of the CRs
+func (c *Condition) DeepCopyInto(out *Condition) {
+	*out = *c
+	c.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// FindCondition returns the condition of the given type, or nil if there is
+// none
+func FindCondition(conditions []Condition, conditionType string) *Condition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// NewConditions returns the conditions of a CR after a Procedure was
+// executed for it: the summary conditions, followed by a condition for each
+// action in status and for each member of a group (see flatten). Skipped
+// actions have Status True and the Reason ActionSkipped. previous are the
+// conditions currently stored in the CR, whose LastTransitionTimes are kept
+// when their Status didn't change. now is used for the others.
+func NewConditions(previous []Condition, status *ProcedureStatus, generation int64, now metav1.Time) []Condition {
+	var notTrue, failed, pending []string
+	for _, ar := range status.Results {
+		if ar.Status != corev1.ConditionTrue {
+			notTrue = append(notTrue, ar.Name)
+		}
+		if _, reason := classify(ar); reason == ReasonActionFailed {
+			failed = append(failed, ar.Name)
+		} else if reason == ReasonActionPending {
+			pending = append(pending, ar.Name)
+		}
+	}
+
+	ready := Condition{Type: ConditionReady, Status: corev1.ConditionTrue,
+		Reason: ReasonReconciled, Message: "all actions are True"}
+	if !status.FullyReconciled {
+		ready.Status, ready.Reason = corev1.ConditionFalse, ReasonNotReconciled
+		ready.Message = fmt.Sprintf("actions not True: %s", strings.Join(notTrue, ", "))
+	}
+	progressing := Condition{Type: ConditionProgressing, Status: corev1.ConditionFalse,
+		Reason: ReasonReconciled, Message: "no actions are pending"}
+	if len(pending) > 0 {
+		progressing.Status, progressing.Reason = corev1.ConditionTrue, ReasonActionPending
+		progressing.Message = fmt.Sprintf("actions pending: %s", strings.Join(pending, ", "))
+	}
+	degraded := Condition{Type: ConditionDegraded, Status: corev1.ConditionFalse,
+		Reason: ReasonNoFailures, Message: "no actions failed"}
+	if len(failed) > 0 {
+		degraded.Status, degraded.Reason = corev1.ConditionTrue, ReasonActionFailed
+		degraded.Message = fmt.Sprintf("actions failed: %s", strings.Join(failed, ", "))
+	}
+
+	conditions := []Condition{ready, progressing, degraded}
+	for _, ar := range flatten(status.Results) {
+		_, reason := classify(ar)
+		c := Condition{
+			Type:    ar.Name,
+			Status:  ar.Status,
+			Reason:  reason,
+			Message: ar.Message,
+		}
+		conditions = append(conditions, c)
+	}
+	for i := range conditions {
+		c := &conditions[i]
+		c.ObservedGeneration = generation
+		c.LastTransitionTime = now
+		if old := FindCondition(previous, c.Type); old != nil && old.Status == c.Status {
+			c.LastTransitionTime = old.LastTransitionTime
+		}
+	}
+	return conditions
+}
+
+// ActionResults returns the Results of the actions recorded in conditions
+// (i.e., all but the summary conditions), e.g., for EventRecorder.Record
+func ActionResults(conditions []Condition) map[string]Result {
+	results := make(map[string]Result)
+	for _, c := range conditions {
+		switch c.Type {
+		case ConditionReady, ConditionProgressing, ConditionDegraded:
+			continue
+		}
+		result := Result{Status: c.Status, Message: c.Message}
+		if c.Reason == ReasonActionSkipped {
+			result.Status, result.Skipped = corev1.ConditionTrue, true
+		}
+		results[c.Type] = result
+	}
+	return results
+}
@@ -0,0 +1,107 @@
+package reconciler
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewConditions(t *testing.T) {
+	t0 := metav1.NewTime(time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC))
+	t1 := metav1.NewTime(t0.Add(time.Minute))
+	t2 := metav1.NewTime(t1.Add(time.Minute))
+
+	pending := &ProcedureStatus{Results: []ActionResult{
+		{Name: "etcd", Result: Result{Status: corev1.ConditionTrue, Message: "ready"}},
+		{Name: "nodes", Result: Result{Status: corev1.ConditionUnknown, Message: "starting"}},
+	}}
+	failed := &ProcedureStatus{Results: []ActionResult{
+		{Name: "etcd", Result: Result{Status: corev1.ConditionTrue, Message: "still ready"}},
+		{Name: "nodes", Result: Result{Status: corev1.ConditionUnknown, Message: "boom"}, Err: errGeneric},
+	}}
+	reconciled := &ProcedureStatus{FullyReconciled: true, Results: []ActionResult{
+		{Name: "etcd", Result: Result{Status: corev1.ConditionTrue, Message: "ready"}},
+		{Name: "nodes", Result: Result{Status: corev1.ConditionTrue, Message: "running"}},
+	}}
+
+	type expected struct {
+		status     corev1.ConditionStatus
+		reason     string
+		transition metav1.Time
+	}
+	var steps = []struct {
+		status     *ProcedureStatus
+		generation int64
+		now        metav1.Time
+		expected   map[string]expected
+	}{
+		{pending, 1, t0, map[string]expected{
+			ConditionReady:       {corev1.ConditionFalse, ReasonNotReconciled, t0},
+			ConditionProgressing: {corev1.ConditionTrue, ReasonActionPending, t0},
+			ConditionDegraded:    {corev1.ConditionFalse, ReasonNoFailures, t0},
+			"etcd":               {corev1.ConditionTrue, ReasonActionSucceeded, t0},
+			"nodes":              {corev1.ConditionUnknown, ReasonActionPending, t0},
+		}},
+		// Only the conditions whose status changed get a new transition
+		// time
+		{failed, 2, t1, map[string]expected{
+			ConditionReady:       {corev1.ConditionFalse, ReasonNotReconciled, t0},
+			ConditionProgressing: {corev1.ConditionFalse, ReasonReconciled, t1},
+			ConditionDegraded:    {corev1.ConditionTrue, ReasonActionFailed, t1},
+			"etcd":               {corev1.ConditionTrue, ReasonActionSucceeded, t0},
+			"nodes":              {corev1.ConditionUnknown, ReasonActionFailed, t0},
+		}},
+		{reconciled, 2, t2, map[string]expected{
+			ConditionReady:       {corev1.ConditionTrue, ReasonReconciled, t2},
+			ConditionProgressing: {corev1.ConditionFalse, ReasonReconciled, t1},
+			ConditionDegraded:    {corev1.ConditionFalse, ReasonNoFailures, t2},
+			"etcd":               {corev1.ConditionTrue, ReasonActionSucceeded, t0},
+			"nodes":              {corev1.ConditionTrue, ReasonActionSucceeded, t2},
+		}},
+	}
+
+	var conditions []Condition
+	for i, step := range steps {
+		conditions = NewConditions(conditions, step.status, step.generation, step.now)
+		if len(conditions) != len(step.expected) {
+			t.Fatalf("step %d: expected %d conditions; got %+v", i, len(step.expected), conditions)
+		}
+		for _, summary := range []string{ConditionReady, ConditionProgressing, ConditionDegraded} {
+			if FindCondition(conditions[:3], summary) == nil {
+				t.Errorf("step %d: summary condition %s should come first", i, summary)
+			}
+		}
+		for name, want := range step.expected {
+			c := FindCondition(conditions, name)
+			if c == nil {
+				t.Errorf("step %d: condition %s is missing", i, name)
+				continue
+			}
+			if c.Status != want.status || c.Reason != want.reason ||
+				!c.LastTransitionTime.Equal(&want.transition) || c.ObservedGeneration != step.generation {
+				t.Errorf("step %d: condition %s: expected %+v; got %+v", i, name, want, *c)
+			}
+		}
+	}
+}
+
+func TestActionResults(t *testing.T) {
+	conditions := NewConditions(nil, &ProcedureStatus{Results: []ActionResult{
+		{Name: "etcd", Result: Result{Status: corev1.ConditionFalse, Message: "down"}},
+		{Name: "csi", Result: Result{Status: corev1.ConditionTrue, Message: "action does not apply", Skipped: true}},
+	}}, 1, metav1.Now())
+	if c := FindCondition(conditions, "csi"); c.Status != corev1.ConditionTrue || c.Reason != ReasonActionSkipped {
+		t.Errorf("unexpected condition for a skipped action: %+v", *c)
+	}
+	results := ActionResults(conditions)
+	if len(results) != 2 || results["etcd"].Status != corev1.ConditionFalse || results["etcd"].Message != "down" {
+		t.Errorf("unexpected action results: %v", results)
+	}
+	// Skipped actions are restored as such, so that no Event is emitted
+	// when the operator restarts
+	if results["csi"] != (Result{Status: corev1.ConditionTrue, Message: "action does not apply", Skipped: true}) {
+		t.Errorf("unexpected result for a skipped action: %+v", results["csi"])
+	}
+}
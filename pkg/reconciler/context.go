@@ -0,0 +1,35 @@
+package reconciler
+
+import (
+	"context"
+)
+
+// StopContext provides a context.Context that is cancelled when the manager
+// is stopped. It implements manager.Runnable so that it can be registered
+// via manager.Add(), causing it to receive the same stop channel as the
+// controllers (i.e., the one from signals.SetupSignalHandler).
+type StopContext struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewStopContext is a constructor for StopContext
+func NewStopContext() *StopContext {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &StopContext{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Context returns the context that will be cancelled when the manager stops
+func (sc *StopContext) Context() context.Context {
+	return sc.ctx
+}
+
+// Start blocks until stop is closed, then cancels the context
+func (sc *StopContext) Start(stop <-chan struct{}) error {
+	<-stop
+	sc.cancel()
+	return nil
+}
@@ -0,0 +1,140 @@
+package reconciler
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// graph is the set of actions reachable from a Procedure, in a stable order
+type graph struct {
+	// procedureLevel are the actions listed in the Procedure
+	procedureLevel []*Action
+	// prereqOnly are the actions that are only reachable as prereqs
+	prereqOnly []*Action
+	// edges maps each action to its (de-duplicated) prereqs
+	edges map[*Action][]*Action
+}
+
+// graph walks the Procedure's actions. Procedure-level actions are listed
+// in definition order, followed by prereq-only actions in the order they are
+// first encountered.
+func (p *Procedure) graph() graph {
+	g := graph{edges: make(map[*Action][]*Action)}
+	seen := make(map[*Action]bool)
+	for _, a := range p.actions {
+		if !seen[a] {
+			seen[a] = true
+			g.procedureLevel = append(g.procedureLevel, a)
+		}
+	}
+	var walk func(a *Action)
+	walk = func(a *Action) {
+		if _, ok := g.edges[a]; ok {
+			return
+		}
+		g.edges[a] = []*Action{}
+		for _, prereq := range a.prereqs {
+			if !seen[prereq] {
+				seen[prereq] = true
+				g.prereqOnly = append(g.prereqOnly, prereq)
+			}
+			if !containsAction(g.edges[a], prereq) {
+				g.edges[a] = append(g.edges[a], prereq)
+			}
+			walk(prereq)
+		}
+	}
+	for _, a := range g.procedureLevel {
+		walk(a)
+	}
+	return g
+}
+
+// all returns all the actions of the graph
+func (g graph) all() []*Action {
+	return append(append([]*Action{}, g.procedureLevel...), g.prereqOnly...)
+}
+
+func containsAction(actions []*Action, a *Action) bool {
+	for _, x := range actions {
+		if x == a {
+			return true
+		}
+	}
+	return false
+}
+
+// DOT renders the Procedure's action graph in the Graphviz DOT language.
+// Procedure-level actions are drawn as rectangles, and actions that are only
+// prerequisites as ovals. Edges point from an action to its prereqs, and
+// dashed edges from a group to its members.
+func (p *Procedure) DOT(name string) string {
+	g := p.graph()
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Generated from the %s Procedure (version %d). DO NOT EDIT.\n", name, p.version)
+	fmt.Fprintf(&b, "# dot -Tpng -O <this_file>\n\n")
+	fmt.Fprintf(&b, "digraph %q {\n", name)
+	fmt.Fprintf(&b, "  label=%q;\n", fmt.Sprintf("%s Procedure", name))
+	fmt.Fprintf(&b, "  nodesep=0.5;\n")
+	fmt.Fprintf(&b, "  rankdir=LR;\n")
+	fmt.Fprintf(&b, "  fontname=\"helvetica\";\n")
+	fmt.Fprintf(&b, "  edge [ dir=forward fontname=\"helvetica\" ];\n")
+	fmt.Fprintf(&b, "  node [ fontname=\"helvetica\" ];\n")
+	fmt.Fprintf(&b, "  graph [ style=\"dotted\" ];\n")
+
+	writeCluster := func(id, label, shape string, actions []*Action) {
+		fmt.Fprintf(&b, "\n  subgraph %s {\n", id)
+		fmt.Fprintf(&b, "    label=%q;\n", label)
+		fmt.Fprintf(&b, "    node [ shape=%s ];\n", shape)
+		for _, a := range actions {
+			fmt.Fprintf(&b, "    %q;\n", a.Name)
+		}
+		fmt.Fprintf(&b, "  }\n")
+	}
+	writeCluster("cluster_ProcedureLevel", "Procedure Level actions", "rect", g.procedureLevel)
+	writeCluster("cluster_PrereqLevel", "Prerequisite actions", "oval", g.prereqOnly)
+
+	b.WriteString("\n")
+	for _, a := range g.all() {
+		for _, prereq := range g.edges[a] {
+			if a.group {
+				fmt.Fprintf(&b, "  %q -> %q [ style=dashed ];\n", a.Name, prereq.Name)
+				continue
+			}
+			fmt.Fprintf(&b, "  %q -> %q;\n", a.Name, prereq.Name)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid renders the Procedure's action graph as a Mermaid flowchart.
+// Procedure-level actions are drawn as rectangles, and actions that are only
+// prerequisites as stadiums. Edges point from an action to its prereqs, and
+// dotted edges from a group to its members.
+func (p *Procedure) Mermaid(name string) string {
+	g := p.graph()
+	ids := make(map[*Action]string)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%%%% Generated from the %s Procedure (version %d). DO NOT EDIT.\n", name, p.version)
+	b.WriteString("graph LR\n")
+	for i, a := range g.all() {
+		ids[a] = fmt.Sprintf("a%d", i)
+	}
+	for _, a := range g.procedureLevel {
+		fmt.Fprintf(&b, "  %s[%q]\n", ids[a], a.Name)
+	}
+	for _, a := range g.prereqOnly {
+		fmt.Fprintf(&b, "  %s([%q])\n", ids[a], a.Name)
+	}
+	for _, a := range g.all() {
+		for _, prereq := range g.edges[a] {
+			arrow := "-->"
+			if a.group {
+				arrow = "-.->"
+			}
+			fmt.Fprintf(&b, "  %s %s %s\n", ids[a], arrow, ids[prereq])
+		}
+	}
+	return b.String()
+}
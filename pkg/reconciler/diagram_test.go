@@ -0,0 +1,66 @@
+package reconciler
+
+import (
+	"testing"
+)
+
+func diagramProcedure() *Procedure {
+	crd := NewAction("crdExists", []*Action{}, trueAction.action)
+	created := NewAction("clusterCreated", []*Action{crd}, trueAction.action)
+	nodes := NewAction("nodesCreated", []*Action{created, crd}, trueAction.action)
+	driver := NewAction("driverDeployed", []*Action{}, trueAction.action)
+	return MustNewProcedure(1, 2, []*Action{nodes, created, driver})
+}
+
+func TestDOT(t *testing.T) {
+	expected := `# Generated from the Example Procedure (version 2). DO NOT EDIT.
+# dot -Tpng -O <this_file>
+
+digraph "Example" {
+  label="Example Procedure";
+  nodesep=0.5;
+  rankdir=LR;
+  fontname="helvetica";
+  edge [ dir=forward fontname="helvetica" ];
+  node [ fontname="helvetica" ];
+  graph [ style="dotted" ];
+
+  subgraph cluster_ProcedureLevel {
+    label="Procedure Level actions";
+    node [ shape=rect ];
+    "nodesCreated";
+    "clusterCreated";
+    "driverDeployed";
+  }
+
+  subgraph cluster_PrereqLevel {
+    label="Prerequisite actions";
+    node [ shape=oval ];
+    "crdExists";
+  }
+
+  "nodesCreated" -> "clusterCreated";
+  "nodesCreated" -> "crdExists";
+  "clusterCreated" -> "crdExists";
+}
+`
+	if actual := diagramProcedure().DOT("Example"); actual != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, actual)
+	}
+}
+
+func TestMermaid(t *testing.T) {
+	expected := `%% Generated from the Example Procedure (version 2). DO NOT EDIT.
+graph LR
+  a0["nodesCreated"]
+  a1["clusterCreated"]
+  a2["driverDeployed"]
+  a3(["crdExists"])
+  a0 --> a1
+  a0 --> a3
+  a1 --> a3
+`
+	if actual := diagramProcedure().Mermaid("Example"); actual != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, actual)
+	}
+}
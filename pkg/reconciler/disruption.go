@@ -0,0 +1,267 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// DisruptionRequeueAfter is the requeue hint given by a disruptive Action
+// that is waiting for the disruption budget, so that it runs during a later
+// reconcile once the disruptions in progress have settled.
+const DisruptionRequeueAfter = 30 * time.Second
+
+// ZoneFunc returns the zone (e.g., the failure domain of a node) disrupted
+// by an Action. Zones are shared by the CRs in a namespace, so the zone
+// should be qualified by whatever the CRs disrupt (e.g., their cluster).
+type ZoneFunc func(context.Context, reconcile.Request, client.Client, *runtime.Scheme) (string, error)
+
+// Disruptive marks the Action as disrupting the system when it applies a
+// change (e.g., by restarting pods). Disruptive Actions are limited by the
+// DisruptionBudget in ctx (see WithDisruptionBudget). zone, if not nil,
+// returns the zone disrupted by the Action, and the budget then applies to
+// each zone separately. Otherwise, the Action only disrupts its own CR.
+func Disruptive(zone ZoneFunc) ActionOption {
+	return func(a *Action) {
+		a.disruptive = true
+		a.zone = zone
+	}
+}
+
+// DefaultDisruptionTimeout is how long a disruptive Action may hold a share
+// of the DisruptionBudget before it is released anyway
+const DefaultDisruptionTimeout = 10 * time.Minute
+
+// DisruptionBudget limits the number of disruptions in progress per zone,
+// across all the CRs reconciled by a controller. A disruptive Action that
+// applies a change holds a share of the budget of its zone until it reports
+// True (i.e., the disruption is over), is skipped, fails (i.e., returns an
+// error or is False), its CR is forgotten, or Timeout expires, so that an
+// Action that never settles can't starve its zone. Disruptive Actions whose
+// check finds the system reconciled, or changes that don't disrupt it (see
+// Result.NonDisruptive), don't use any budget. Those that exceed the budget
+// are reported as Unknown w/ a requeue hint of DisruptionRequeueAfter, and
+// listed in ProcedureStatus.WaitingForBudget. Which of the competing Actions
+// gets the budget is arbitrary. A single DisruptionBudget is shared by all
+// the reconciles of a controller.
+//
+// The budget is only kept in memory: it paces the changes applied by the
+// operator, and persisting it would need an object shared by all the CRs of
+// a zone, which would still have to be timed out after a crash. Once the
+// operator restarts, the disruptions that were in progress are no longer
+// counted, so new ones may start before they are over.
+type DisruptionBudget struct {
+	// Timeout is how long an Action may hold a share of the budget; zero
+	// is unlimited
+	Timeout time.Duration
+
+	limit int
+	// now returns the current time
+	now func() time.Time
+
+	// mutex protects holders
+	mutex sync.Mutex
+	// holders are the disruptions in progress in each zone, by CR and
+	// Action, and when they started
+	holders map[string]map[string]time.Time
+}
+
+// NewDisruptionBudget is a constructor for DisruptionBudget, allowing up to
+// limit disruptions per zone (zero is unlimited) for up to
+// DefaultDisruptionTimeout each
+func NewDisruptionBudget(limit int) *DisruptionBudget {
+	return &DisruptionBudget{
+		Timeout: DefaultDisruptionTimeout,
+		limit:   limit,
+		now:     time.Now,
+		holders: make(map[string]map[string]time.Time),
+	}
+}
+
+// take uses one disruption in the zone on behalf of the holder, returning
+// false if there is none left. A holder that already has one keeps it until
+// it times out.
+func (b *DisruptionBudget) take(zone, holder string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.now()
+	holders := b.holders[zone]
+	for h, since := range holders {
+		if b.Timeout > 0 && now.Sub(since) >= b.Timeout {
+			delete(holders, h)
+		}
+	}
+	if _, ok := holders[holder]; ok {
+		return true
+	}
+	if b.limit > 0 && len(holders) >= b.limit {
+		return false
+	}
+	if holders == nil {
+		holders = make(map[string]time.Time)
+		b.holders[zone] = holders
+	}
+	holders[holder] = now
+	return true
+}
+
+// release ends the disruptions of the holders for which done returns true
+func (b *DisruptionBudget) release(done func(holder string) bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for zone, holders := range b.holders {
+		for holder := range holders {
+			if done(holder) {
+				delete(holders, holder)
+			}
+		}
+		if len(holders) == 0 {
+			delete(b.holders, zone)
+		}
+	}
+}
+
+// Forget ends the disruptions of the named CR, e.g., once it is deleted
+func (b *DisruptionBudget) Forget(name types.NamespacedName) {
+	prefix := name.String() + "/"
+	b.release(func(holder string) bool { return strings.HasPrefix(holder, prefix) })
+}
+
+type budgetKey struct{}
+
+// WithDisruptionBudget returns a context that limits the disruptive Actions
+// executed with it to the budget. W/o a budget, they are not limited.
+func WithDisruptionBudget(ctx context.Context, b *DisruptionBudget) context.Context {
+	return context.WithValue(ctx, budgetKey{}, b)
+}
+
+// budgetUse tracks the use of the DisruptionBudget by an execution
+type budgetUse struct {
+	mutex sync.Mutex
+	// waiting are the names of the Actions that exceeded the budget
+	waiting []string
+	// ended are the holders whose disruptions are over
+	ended map[string]bool
+}
+
+// wait records that the Action is waiting for the budget
+func (u *budgetUse) wait(a *Action) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.waiting = append(u.waiting, a.Name)
+}
+
+// end records that the disruption of the holder is over
+func (u *budgetUse) end(holder string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.ended == nil {
+		u.ended = make(map[string]bool)
+	}
+	u.ended[holder] = true
+}
+
+// release returns the budget held by the disruptions that ended during the
+// execution. It is done once the execution is over, even if it was
+// cancelled, so that, within an execution, every disruption counts.
+func (u *budgetUse) release(ctx context.Context) {
+	b, ok := ctx.Value(budgetKey{}).(*DisruptionBudget)
+	if u == nil || !ok || b == nil {
+		return
+	}
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	b.release(func(holder string) bool { return u.ended[holder] })
+}
+
+// waitingActions returns the sorted names of the Actions that exceeded the
+// budget
+func (u *budgetUse) waitingActions() []string {
+	if u == nil {
+		return nil
+	}
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if len(u.waiting) == 0 {
+		return nil
+	}
+	waiting := append([]string{}, u.waiting...)
+	sort.Strings(waiting)
+	return waiting
+}
+
+type budgetUseKey struct{}
+
+// withBudgetUse returns a context that records the use of the budget by the
+// Actions run with it in u
+func withBudgetUse(ctx context.Context, u *budgetUse) context.Context {
+	if u == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, budgetUseKey{}, u)
+}
+
+// holder identifies the disruption of the Action for the CR
+func (ra *Action) holder(request reconcile.Request) string {
+	return request.NamespacedName.String() + "/" + ra.Name
+}
+
+// endDisruption records that the disruption of the Action for the CR, if
+// any, is over once the Action is True, or no longer holds the budget once
+// it fails
+func (ra *Action) endDisruption(ctx context.Context, request reconcile.Request, result Result, err error) {
+	u, ok := ctx.Value(budgetUseKey{}).(*budgetUse)
+	if !ra.disruptive || !ok || (err == nil && result.Status == corev1.ConditionUnknown) {
+		return
+	}
+	u.end(ra.holder(request))
+}
+
+// takeBudget is called before the Action applies a change, w/ the Result of
+// its check, if any. If the Action is disruptive, the change disrupts the
+// system and the budget of its zone is used up, it returns the Result to
+// report instead, and false.
+func (ra *Action) takeBudget(ctx context.Context, checked Result, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (Result, bool, error) {
+	b, ok := ctx.Value(budgetKey{}).(*DisruptionBudget)
+	if !ra.disruptive || checked.NonDisruptive || !ok || b == nil {
+		return Result{}, true, nil
+	}
+	// Zones are scoped to the namespace; w/o a zone, the Action only
+	// disrupts its own CR
+	zone := ""
+	key := request.NamespacedName.String()
+	if ra.zone != nil {
+		var err error
+		if zone, err = ra.zone(ctx, request, client, scheme); err != nil {
+			return Result{
+				Status:  corev1.ConditionUnknown,
+				Message: fmt.Sprintf("unable to determine zone: %v", err),
+			}, false, err
+		}
+		key = request.Namespace + "/" + zone
+	}
+	if b.take(key, ra.holder(request)) {
+		return Result{}, true, nil
+	}
+	if u, ok := ctx.Value(budgetUseKey{}).(*budgetUse); ok {
+		u.wait(ra)
+	}
+	message := "waiting for disruption budget"
+	if zone != "" {
+		message = fmt.Sprintf("waiting for disruption budget in zone %s", zone)
+	}
+	return Result{
+		Status:       corev1.ConditionUnknown,
+		Message:      message,
+		RequeueAfter: DisruptionRequeueAfter,
+	}, false, nil
+}
@@ -0,0 +1,280 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// inZone returns a ZoneFunc for the given zone
+func inZone(zone string) ZoneFunc {
+	return func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (string, error) {
+		return zone, nil
+	}
+}
+
+func TestDisruptionBudget(t *testing.T) {
+	reconciled := WithCheck(trueAction.action)
+	nonDisruptive := WithCheck(func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+		return Result{Status: corev1.ConditionUnknown, Message: "would be created", NonDisruptive: true}, nil
+	})
+	var tests = []struct {
+		name        string
+		budget      int
+		actions     []*Action
+		wantWaiting int
+	}{
+		{"unlimited", 0, []*Action{
+			NewAction("a", []*Action{}, trueAction.action, Disruptive(nil)),
+			NewAction("b", []*Action{}, trueAction.action, Disruptive(nil)),
+		}, 0},
+		{"whole CR", 1, []*Action{
+			NewAction("a", []*Action{}, trueAction.action, Disruptive(nil)),
+			NewAction("b", []*Action{}, trueAction.action, Disruptive(nil)),
+			NewAction("c", []*Action{}, trueAction.action, Disruptive(nil)),
+			NewAction("safe", []*Action{}, trueAction.action),
+		}, 2},
+		{"per zone", 1, []*Action{
+			NewAction("a1", []*Action{}, trueAction.action, Disruptive(inZone("a"))),
+			NewAction("a2", []*Action{}, trueAction.action, Disruptive(inZone("a"))),
+			NewAction("b1", []*Action{}, trueAction.action, Disruptive(inZone("b"))),
+		}, 1},
+		{"reconciled actions use no budget", 1, []*Action{
+			NewAction("a", []*Action{}, falseAction.action, Disruptive(nil), reconciled),
+			NewAction("b", []*Action{}, falseAction.action, Disruptive(nil), reconciled),
+			NewAction("c", []*Action{}, trueAction.action, Disruptive(nil)),
+		}, 0},
+		{"non-disruptive changes use no budget", 1, []*Action{
+			NewAction("a", []*Action{}, trueAction.action, Disruptive(nil), nonDisruptive),
+			NewAction("b", []*Action{}, trueAction.action, Disruptive(nil), nonDisruptive),
+			NewAction("c", []*Action{}, trueAction.action, Disruptive(nil)),
+		}, 0},
+	}
+	for _, tt := range tests {
+		p := MustNewProcedure(0, 0, tt.actions)
+		client := fake.NewFakeClient()
+		ctx := WithDisruptionBudget(context.TODO(), NewDisruptionBudget(tt.budget))
+		status, err := p.Execute(ctx, reconcile.Request{}, client, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if len(status.WaitingForBudget) != tt.wantWaiting {
+			t.Errorf("%s: expected %d actions waiting for budget; got %v", tt.name, tt.wantWaiting, status.WaitingForBudget)
+		}
+		waiting := make(map[string]bool)
+		for _, name := range status.WaitingForBudget {
+			waiting[name] = true
+		}
+		for _, ar := range status.Results {
+			if !waiting[ar.Name] {
+				if ar.Status != corev1.ConditionTrue {
+					t.Errorf("%s: unexpected result for %s: %+v", tt.name, ar.Name, ar.Result)
+				}
+				continue
+			}
+			if ar.Status != corev1.ConditionUnknown || ar.RequeueAfter != DisruptionRequeueAfter {
+				t.Errorf("%s: unexpected result for %s, which is waiting: %+v", tt.name, ar.Name, ar.Result)
+			}
+		}
+		if tt.wantWaiting > 0 && (status.FullyReconciled || status.RequeueAfter != DisruptionRequeueAfter) {
+			t.Errorf("%s: waiting actions should requeue: %+v", tt.name, status)
+		}
+	}
+}
+
+func TestDisruptionBudgetMessages(t *testing.T) {
+	a := NewAction("a", []*Action{}, trueAction.action, Disruptive(inZone("zone-1")))
+	b := NewAction("b", []*Action{a}, trueAction.action, Disruptive(inZone("zone-1")))
+	errZone := errors.New("no zone")
+	c := NewAction("c", []*Action{}, trueAction.action, Disruptive(
+		func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (string, error) {
+			return "", errZone
+		}))
+	p := MustNewProcedure(0, 0, []*Action{b, c})
+	client := fake.NewFakeClient()
+	ctx := WithDisruptionBudget(context.TODO(), NewDisruptionBudget(1))
+	status, err := p.Execute(ctx, reconcile.Request{}, client, nil)
+	if err == nil {
+		t.Errorf("expected the error of the zone function")
+	}
+	if got := status.Results[0]; got.Message != "waiting for disruption budget in zone zone-1" {
+		t.Errorf("unexpected result for b: %+v", got.Result)
+	}
+	if len(status.WaitingForBudget) != 1 || status.WaitingForBudget[0] != "b" {
+		t.Errorf("expected b to be waiting; got %v", status.WaitingForBudget)
+	}
+}
+
+func TestDisruptionBudgetOnlyLimitsApply(t *testing.T) {
+	actions := []*Action{
+		NewAction("a", []*Action{}, trueAction.action, Disruptive(nil)),
+		NewAction("b", []*Action{}, trueAction.action, Disruptive(nil)),
+	}
+	p := MustNewProcedure(0, 0, actions)
+	client := fake.NewFakeClient()
+	ctx := WithDisruptionBudget(context.TODO(), NewDisruptionBudget(1))
+	status, err := p.Teardown(ctx, reconcile.Request{}, client, nil)
+	if err != nil || !status.FullyReconciled || len(status.WaitingForBudget) != 0 {
+		t.Errorf("teardown should not be limited: %+v, %v", status, err)
+	}
+}
+
+func TestDisruptionBudgetIsShared(t *testing.T) {
+	zones := map[string]string{"a1": "a", "a2": "a", "b1": "b", "a3": "a"}
+	// restarted are the CRs whose restart is over
+	restarted := make(map[string]bool)
+	var mutex sync.Mutex
+	restart := NewAction("restart", []*Action{},
+		func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+			return Result{Status: corev1.ConditionUnknown, Message: "restarting"}, nil
+		},
+		WithCheck(func(_ context.Context, request reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if restarted[request.Name] {
+				return Result{Status: corev1.ConditionTrue, Message: "restarted"}, nil
+			}
+			return Result{Status: corev1.ConditionUnknown, Message: "needs a restart"}, nil
+		}),
+		Disruptive(func(_ context.Context, request reconcile.Request, _ client.Client, _ *runtime.Scheme) (string, error) {
+			return zones[request.Name], nil
+		}))
+	p := MustNewProcedure(0, 0, []*Action{restart})
+	budget := NewDisruptionBudget(1)
+	ctx := WithDisruptionBudget(context.TODO(), budget)
+	client := fake.NewFakeClient()
+	request := func(name string) reconcile.Request {
+		return reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: "namespace"}}
+	}
+
+	var steps = []struct {
+		name      string
+		cr        string
+		restarted bool
+		forget    string
+		want      string
+	}{
+		{"first in zone", "a1", false, "", "restarting"},
+		{"zone busy", "a2", false, "", "waiting for disruption budget in zone a"},
+		{"other zone", "b1", false, "", "restarting"},
+		{"still restarting", "a1", false, "", "restarting"},
+		{"zone still busy", "a2", false, "", "waiting for disruption budget in zone a"},
+		{"restart over", "a1", true, "", "restarted"},
+		{"zone free", "a2", false, "", "restarting"},
+		{"zone busy again", "a3", false, "", "waiting for disruption budget in zone a"},
+		{"deleted CR forgotten", "a3", false, "a2", "restarting"},
+	}
+	for _, step := range steps {
+		mutex.Lock()
+		restarted[step.cr] = step.restarted
+		mutex.Unlock()
+		if step.forget != "" {
+			budget.Forget(request(step.forget).NamespacedName)
+		}
+		status, err := p.Execute(ctx, request(step.cr), client, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		if got := status.Results[0]; got.Message != step.want {
+			t.Errorf("%s: expected %q; got %+v", step.name, step.want, got.Result)
+		}
+	}
+}
+
+func TestDisruptionBudgetIsBounded(t *testing.T) {
+	// outcomes are the results of restarting each CR
+	outcomes := make(map[string]string)
+	var mutex sync.Mutex
+	restart := NewAction("restart", []*Action{},
+		func(_ context.Context, request reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			switch outcomes[request.Name] {
+			case "error":
+				return Result{Status: corev1.ConditionUnknown, Message: "unable to restart"}, errGeneric
+			case "false":
+				return Result{Status: corev1.ConditionFalse, Message: "restart failed"}, nil
+			}
+			return Result{Status: corev1.ConditionUnknown, Message: "restarting"}, nil
+		},
+		Disruptive(inZone("a")))
+	p := MustNewProcedure(0, 0, []*Action{restart})
+	budget := NewDisruptionBudget(1)
+	now := time.Now()
+	budget.now = func() time.Time { return now }
+	ctx := WithDisruptionBudget(context.TODO(), budget)
+	client := fake.NewFakeClient()
+	request := func(name string) reconcile.Request {
+		return reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: "namespace"}}
+	}
+
+	var steps = []struct {
+		name    string
+		cr      string
+		outcome string
+		elapsed time.Duration
+		want    string
+	}{
+		{"first in zone", "a1", "", 0, "restarting"},
+		{"zone busy", "a2", "", 0, "waiting for disruption budget in zone a"},
+		{"error releases the budget", "a1", "error", 0, "error: an error"},
+		{"zone free after error", "a2", "", 0, "restarting"},
+		{"zone busy again", "a1", "", 0, "waiting for disruption budget in zone a"},
+		{"false releases the budget", "a2", "false", 0, "restart failed"},
+		{"zone free after false", "a3", "", 0, "restarting"},
+		{"zone busy until timeout", "a1", "", DefaultDisruptionTimeout - time.Second, "waiting for disruption budget in zone a"},
+		{"timeout releases the budget", "a1", "", time.Second, "restarting"},
+	}
+	for _, step := range steps {
+		mutex.Lock()
+		outcomes[step.cr] = step.outcome
+		mutex.Unlock()
+		now = now.Add(step.elapsed)
+		status, _ := p.Execute(ctx, request(step.cr), client, nil)
+		if got := status.Results[0]; got.Message != step.want {
+			t.Errorf("%s: expected %q; got %+v", step.name, step.want, got.Result)
+		}
+	}
+}
+
+func TestCancelledExecutionReleasesTheBudget(t *testing.T) {
+	budget := NewDisruptionBudget(1)
+	ctx, cancel := context.WithCancel(WithDisruptionBudget(context.TODO(), budget))
+	defer cancel()
+	restart := NewAction("restart", []*Action{},
+		func(_ context.Context, request reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+			if request.Name == "a1" {
+				// The operator shuts down as the restart fails
+				cancel()
+				return Result{Status: corev1.ConditionFalse, Message: "restart failed"}, nil
+			}
+			return Result{Status: corev1.ConditionUnknown, Message: "restarting"}, nil
+		},
+		Disruptive(inZone("a")))
+	p := MustNewProcedure(0, 0, []*Action{restart})
+	client := fake.NewFakeClient()
+	request := func(name string) reconcile.Request {
+		return reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: "namespace"}}
+	}
+
+	if _, err := p.Execute(ctx, request("a1"), client, nil); err != context.Canceled {
+		t.Fatalf("expected the execution to be cancelled; got %v", err)
+	}
+	ctx = WithDisruptionBudget(context.TODO(), budget)
+	status, err := p.Execute(ctx, request("a2"), client, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := status.Results[0]; got.Message != "restarting" {
+		t.Errorf("expected the budget of a1 to be released; got %+v", got.Result)
+	}
+}
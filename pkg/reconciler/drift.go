@@ -0,0 +1,140 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DriftPolicy decides what EnsureObject Actions do when an object they
+// manage has drifted, i.e. fields that the operator owns were changed by
+// someone else
+type DriftPolicy string
+
+const (
+	// DriftReport leaves drifted objects alone and reports the drift. It is
+	// the default.
+	DriftReport DriftPolicy = "report"
+	// DriftCorrect reports the drift, and changes the drifted fields back
+	DriftCorrect DriftPolicy = "correct"
+)
+
+// Validate checks that the policy is known. The empty policy is DriftReport.
+func (p DriftPolicy) Validate() error {
+	switch p {
+	case "", DriftReport, DriftCorrect:
+		return nil
+	}
+	return fmt.Errorf("unknown drift policy %q (available: %s, %s)", p, DriftCorrect, DriftReport)
+}
+
+// Drift describes an object whose fields owned by the operator were changed
+// by someone else
+type Drift struct {
+	// Action is the name of the action that manages the object
+	Action string `json:"action"`
+	// Object is the kind and key of the object (e.g., "StatefulSet ns/name")
+	Object string `json:"object"`
+	// Fields are the paths of the fields that drifted
+	Fields []string `json:"fields,omitempty"`
+	// Corrected is true if the fields were changed back
+	Corrected bool `json:"corrected,omitempty"`
+}
+
+// DeepCopyInto copies the receiver into out, for the generated deepcopy
+// functions of the CRs
+func (d *Drift) DeepCopyInto(out *Drift) {
+	*out = *d
+	if d.Fields != nil {
+		out.Fields = append([]string{}, d.Fields...)
+	}
+}
+
+// String describes the drift for events and logs
+func (d Drift) String() string {
+	if d.Corrected {
+		return fmt.Sprintf("%s had drifted and was corrected (%s)", d.Object, d.fieldList())
+	}
+	return fmt.Sprintf("%s has drifted (%s)", d.Object, d.fieldList())
+}
+
+// fieldList returns the fields that drifted, for messages
+func (d Drift) fieldList() string {
+	if len(d.Fields) == 0 {
+		return "fields changed by someone else"
+	}
+	return strings.Join(d.Fields, ", ")
+}
+
+type driftPolicyKey struct{}
+
+// WithDriftPolicy returns a context that causes the EnsureObject Actions
+// executed with it to follow the policy (normally, that of the CR being
+// reconciled). An invalid policy is reported by the Actions as an invalid
+// configuration error.
+func WithDriftPolicy(ctx context.Context, policy DriftPolicy) context.Context {
+	return context.WithValue(ctx, driftPolicyKey{}, policy)
+}
+
+// driftPolicyFrom returns the policy set by WithDriftPolicy, or DriftReport
+// if there is none
+func driftPolicyFrom(ctx context.Context) (DriftPolicy, error) {
+	policy, _ := ctx.Value(driftPolicyKey{}).(DriftPolicy)
+	if err := policy.Validate(); err != nil {
+		return "", InvalidConfig(err)
+	}
+	if policy == "" {
+		return DriftReport, nil
+	}
+	return policy, nil
+}
+
+// driftLog collects the drift found during an execution
+type driftLog struct {
+	mutex sync.Mutex
+	drift []Drift
+}
+
+// add records the drift of an object
+func (l *driftLog) add(d Drift) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.drift = append(l.drift, d)
+}
+
+// sorted returns the drift found, sorted by action and object
+func (l *driftLog) sorted() []Drift {
+	if l == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	drift := append([]Drift{}, l.drift...)
+	sort.Slice(drift, func(i, j int) bool {
+		if drift[i].Action != drift[j].Action {
+			return drift[i].Action < drift[j].Action
+		}
+		return drift[i].Object < drift[j].Object
+	})
+	return drift
+}
+
+type driftLogKey struct{}
+
+// withDriftLog returns a context that records the drift found by the
+// EnsureObject Actions run with it in l
+func withDriftLog(ctx context.Context, l *driftLog) context.Context {
+	if l == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, driftLogKey{}, l)
+}
+
+// recordDrift records drift in the log of the execution, if any
+func recordDrift(ctx context.Context, d Drift) {
+	if l, ok := ctx.Value(driftLogKey{}).(*driftLog); ok {
+		l.add(d)
+	}
+}
@@ -0,0 +1,281 @@
+package reconciler
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestDriftPolicies(t *testing.T) {
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "owner", Namespace: "namespace"}}
+	key := types.NamespacedName{Name: "ensured", Namespace: "namespace"}
+	drift := Drift{
+		Action: "ensured",
+		Object: "StatefulSet namespace/ensured",
+		Fields: []string{"spec.template.spec.containers"},
+	}
+	var tests = []struct {
+		policy      DriftPolicy
+		wantPlan    string
+		wantCond    corev1.ConditionStatus
+		wantMessage string
+		wantImage   string
+	}{
+		{"", "StatefulSet namespace/ensured has drifted (spec.template.spec.containers)",
+			corev1.ConditionFalse, "StatefulSet namespace/ensured has drifted (spec.template.spec.containers)",
+			"other:latest"},
+		{DriftReport, "StatefulSet namespace/ensured has drifted (spec.template.spec.containers)",
+			corev1.ConditionFalse, "StatefulSet namespace/ensured has drifted (spec.template.spec.containers)",
+			"other:latest"},
+		{DriftCorrect, "StatefulSet namespace/ensured has drifted and would be corrected (spec.template.spec.containers)",
+			corev1.ConditionUnknown, "StatefulSet namespace/ensured had drifted and was corrected (spec.template.spec.containers)",
+			"ensured:latest"},
+	}
+	for _, tt := range tests {
+		owner := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "namespace"},
+			Data:       map[string]string{"image": "ensured:latest"},
+		}
+		client := fake.NewFakeClient(owner)
+		p := MustNewProcedure(0, 0, []*Action{EnsureObject("ensured", []*Action{}, desiredStatefulSet)})
+		ctx := WithDriftPolicy(context.TODO(), tt.policy)
+		if _, err := p.Execute(ctx, request, client, scheme.Scheme); err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.policy, err)
+		}
+		ss := &appsv1.StatefulSet{}
+		if err := client.Get(ctx, key, ss); err != nil {
+			t.Fatalf("%q: unable to get the StatefulSet: %v", tt.policy, err)
+		}
+		ss.Spec.Template.Spec.Containers[0].Image = "other:latest"
+		if err := client.Update(ctx, ss); err != nil {
+			t.Fatalf("%q: unable to update the StatefulSet: %v", tt.policy, err)
+		}
+
+		changes, err := p.Plan(ctx, request, client, scheme.Scheme)
+		if err != nil || len(changes) != 1 || changes[0].Message != tt.wantPlan {
+			t.Errorf("%q: expected plan %q; got %+v, %v", tt.policy, tt.wantPlan, changes, err)
+		}
+		status, err := p.Execute(ctx, request, client, scheme.Scheme)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.policy, err)
+		}
+		if got := status.Results[0]; got.Status != tt.wantCond || got.Message != tt.wantMessage {
+			t.Errorf("%q: expected %v %q; got %+v", tt.policy, tt.wantCond, tt.wantMessage, got.Result)
+		}
+		want := drift
+		want.Corrected = tt.policy == DriftCorrect
+		if !reflect.DeepEqual(status.Drift, []Drift{want}) {
+			t.Errorf("%q: expected drift %+v; got %+v", tt.policy, want, status.Drift)
+		}
+		if err := client.Get(ctx, key, ss); err != nil {
+			t.Fatalf("%q: unable to get the StatefulSet: %v", tt.policy, err)
+		}
+		if image := ss.Spec.Template.Spec.Containers[0].Image; image != tt.wantImage {
+			t.Errorf("%q: expected image %s; got %s", tt.policy, tt.wantImage, image)
+		}
+	}
+}
+
+func TestDriftOnlyHoldsBackDriftedFields(t *testing.T) {
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "owner", Namespace: "namespace"}}
+	owner := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "namespace"},
+		Data:       map[string]string{"image": "ensured:latest", "service": "ensured"},
+	}
+	// The service name of the StatefulSet follows the owner too
+	desired := func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (runtime.Object, metav1.Object, error) {
+		obj, owner, err := desiredStatefulSet(ctx, request, client, scheme)
+		if err != nil {
+			return nil, nil, err
+		}
+		cm := owner.(*corev1.ConfigMap)
+		obj.(*appsv1.StatefulSet).Spec.ServiceName = cm.Data["service"]
+		return obj, owner, nil
+	}
+	client := fake.NewFakeClient(owner)
+	p := MustNewProcedure(0, 0, []*Action{EnsureObject("ensured", []*Action{}, desired)})
+	key := types.NamespacedName{Name: "ensured", Namespace: "namespace"}
+	get := func() *appsv1.StatefulSet {
+		ss := &appsv1.StatefulSet{}
+		if err := client.Get(context.TODO(), key, ss); err != nil {
+			t.Fatalf("unable to get the StatefulSet: %v", err)
+		}
+		return ss
+	}
+	if _, err := p.Execute(context.TODO(), request, client, scheme.Scheme); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ss := get()
+	ss.Spec.Template.Spec.Containers[0].Image = "other:latest"
+	if err := client.Update(context.TODO(), ss); err != nil {
+		t.Fatalf("unable to update the StatefulSet: %v", err)
+	}
+	owner.Data["service"] = "renamed"
+	if err := client.Update(context.TODO(), owner); err != nil {
+		t.Fatalf("unable to update the owner: %v", err)
+	}
+
+	var steps = []struct {
+		name        string
+		wantPlan    string
+		wantUpdated bool
+	}{
+		{"other fields changed", "StatefulSet namespace/ensured has drifted (spec.template.spec.containers), and its other fields would be updated", true},
+		{"steady", "StatefulSet namespace/ensured has drifted (spec.template.spec.containers)", false},
+	}
+	for _, step := range steps {
+		changes, err := p.Plan(context.TODO(), request, client, scheme.Scheme)
+		if err != nil || len(changes) != 1 || changes[0].Message != step.wantPlan {
+			t.Errorf("%s: expected plan %q; got %+v, %v", step.name, step.wantPlan, changes, err)
+		}
+		before := get().ResourceVersion
+		status, err := p.Execute(context.TODO(), request, client, scheme.Scheme)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		// Only the drifted fields are reported
+		want := "StatefulSet namespace/ensured has drifted (spec.template.spec.containers)"
+		if got := status.Results[0]; got.Status != corev1.ConditionFalse || got.Message != want {
+			t.Errorf("%s: expected %v %q; got %+v", step.name, corev1.ConditionFalse, want, got.Result)
+		}
+		ss := get()
+		if updated := ss.ResourceVersion != before; updated != step.wantUpdated {
+			t.Errorf("%s: expected updated: %v; got %v", step.name, step.wantUpdated, updated)
+		}
+		if ss.Spec.ServiceName != "renamed" || ss.Spec.Template.Spec.Containers[0].Image != "other:latest" {
+			t.Errorf("%s: expected the service to be renamed and the image to be left alone; got %s, %s",
+				step.name, ss.Spec.ServiceName, ss.Spec.Template.Spec.Containers[0].Image)
+		}
+	}
+
+	// The drift is gone once the field is changed back
+	ss = get()
+	ss.Spec.Template.Spec.Containers[0].Image = "ensured:latest"
+	if err := client.Update(context.TODO(), ss); err != nil {
+		t.Fatalf("unable to update the StatefulSet: %v", err)
+	}
+	status, err := p.Execute(context.TODO(), request, client, scheme.Scheme)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(status.Drift) != 0 || status.Results[0].Status == corev1.ConditionFalse {
+		t.Errorf("expected no drift; got %+v, %+v", status.Drift, status.Results[0].Result)
+	}
+}
+
+func TestInvalidDriftPolicy(t *testing.T) {
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "owner", Namespace: "namespace"}}
+	owner := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "namespace"}}
+	client := fake.NewFakeClient(owner)
+	p := MustNewProcedure(0, 0, []*Action{EnsureObject("ensured", []*Action{}, desiredStatefulSet)})
+	ctx := WithDriftPolicy(context.TODO(), "ignore")
+	_, err := p.Execute(ctx, request, client, scheme.Scheme)
+	if !IsInvalidConfig(err) || !strings.Contains(err.Error(), `unknown drift policy "ignore"`) {
+		t.Errorf("expected an invalid config error; got %v", err)
+	}
+}
+
+func TestSecretDataIsHashed(t *testing.T) {
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "owner", Namespace: "namespace"}}
+	owner := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "namespace"}}
+	desired := func(ctx context.Context, request reconcile.Request, _ client.Client, _ *runtime.Scheme) (runtime.Object, metav1.Object, error) {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "ensured", Namespace: request.Namespace},
+			Data:       map[string][]byte{"password": []byte("secret")},
+		}, nil, nil
+	}
+	p := MustNewProcedure(0, 0, []*Action{EnsureObject("ensured", []*Action{}, desired)})
+	client := fake.NewFakeClient(owner)
+	key := types.NamespacedName{Name: "ensured", Namespace: "namespace"}
+
+	var steps = []struct {
+		name        string
+		password    string
+		wantMessage string
+	}{
+		{"created", "", "created Secret namespace/ensured"},
+		{"unchanged", "", "Secret namespace/ensured is rolled out"},
+		{"changed by others", "changed", "Secret namespace/ensured has drifted (data.password)"},
+	}
+	for _, step := range steps {
+		if step.password != "" {
+			secret := &corev1.Secret{}
+			if err := client.Get(context.TODO(), key, secret); err != nil {
+				t.Fatalf("%s: unable to get the Secret: %v", step.name, err)
+			}
+			secret.Data["password"] = []byte(step.password)
+			if err := client.Update(context.TODO(), secret); err != nil {
+				t.Fatalf("%s: unable to update the Secret: %v", step.name, err)
+			}
+		}
+		status, err := p.Execute(context.TODO(), request, client, scheme.Scheme)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		if got := status.Results[0]; got.Message != step.wantMessage {
+			t.Errorf("%s: expected %q; got %+v", step.name, step.wantMessage, got.Result)
+		}
+	}
+
+	secret := &corev1.Secret{}
+	if err := client.Get(context.TODO(), key, secret); err != nil {
+		t.Fatalf("unable to get the Secret: %v", err)
+	}
+	// "secret", base64 encoded
+	if lastApplied := secret.Annotations[LastAppliedAnnotation]; strings.Contains(lastApplied, "c2VjcmV0") {
+		t.Errorf("the data of the Secret should not be recorded; got %s", lastApplied)
+	}
+}
+
+func TestDriftEvents(t *testing.T) {
+	fake := record.NewFakeRecorder(100)
+	events := NewEventRecorder(fake)
+	obj := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "name", Namespace: "namespace"}}
+	reported := Drift{Action: "a", Object: "Service ns/a", Fields: []string{"spec.ports"}}
+	corrected := Drift{Action: "b", Object: "DaemonSet ns/b", Fields: []string{"spec.template"}, Corrected: true}
+
+	var steps = []struct {
+		previous []Drift
+		drift    []Drift
+		expected []string
+	}{
+		{nil, []Drift{reported, corrected}, []string{
+			"Warning DriftDetected Service ns/a has drifted (spec.ports)",
+			"Warning DriftCorrected DaemonSet ns/b had drifted and was corrected (spec.template)",
+		}},
+		// Drift that is still reported isn't repeated
+		{[]Drift{reported}, []Drift{reported}, nil},
+		{[]Drift{reported}, []Drift{{Action: "a", Object: "Service ns/a", Fields: []string{"spec.selector"}}}, []string{
+			"Warning DriftDetected Service ns/a has drifted (spec.selector)",
+		}},
+	}
+	for i, step := range steps {
+		events.RecordDrift(obj, step.previous, step.drift)
+		if got := drain(fake); !reflect.DeepEqual(got, step.expected) {
+			t.Errorf("step %d: expected events %q; got %q", i, step.expected, got)
+		}
+	}
+}
+
+func TestDriftPolicyValidate(t *testing.T) {
+	for _, policy := range []DriftPolicy{"", DriftReport, DriftCorrect} {
+		if err := policy.Validate(); err != nil {
+			t.Errorf("%q: unexpected error: %v", policy, err)
+		}
+	}
+	if err := DriftPolicy("Correct").Validate(); err == nil {
+		t.Errorf("expected policies to be case sensitive")
+	}
+}
@@ -0,0 +1,691 @@
+package reconciler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// RolloutRequeueAfter is the requeue hint given by an EnsureObject Action
+// while the object is being rolled out
+const RolloutRequeueAfter = 10 * time.Second
+
+// LastAppliedAnnotation records, on each object ensured by an EnsureObject
+// Action, the configuration that the operator last applied to it. The fields
+// set in that configuration are the ones owned by the operator.
+const LastAppliedAnnotation = "operator.gluster.org/last-applied-configuration"
+
+// FieldManager is the field manager that applies the objects ensured by
+// EnsureObject Actions w/ server-side apply (see serverside.go)
+const FieldManager = "anthill"
+
+// serverSideApply, if set, applies the desired object w/ server-side apply
+// instead of the client-side merge (see serverside.go)
+var serverSideApply func(e ensurer, ctx context.Context, obj, existing runtime.Object, policy DriftPolicy, client client.Client, scheme *runtime.Scheme) (Result, error)
+
+// DesiredFunc returns the desired state of the object ensured by an
+// EnsureObject Action, and the owner that is to be its controller (normally
+// the CR being reconciled), if any. The object must be a typed object with
+// its name and namespace set (i.e., a pointer to a struct).
+type DesiredFunc func(context.Context, reconcile.Request, client.Client, *runtime.Scheme) (runtime.Object, metav1.Object, error)
+
+// EnsureObject returns an Action that ensures the object returned by desired
+// exists and matches it. The owner is set as the controller of the object,
+// using the scheme. The object is created if it is missing, and applied if it
+// has drifted from the desired object.
+//
+// Applying an object only changes the fields that the operator owns, i.e.
+// those set in the desired object, so that changes made by others to other
+// fields (e.g., a sidecar or an annotation added by an admin) survive. The
+// fields owned are recorded in LastAppliedAnnotation, which allows fields
+// that are no longer desired to be removed. By default, this is the
+// client-side three-way merge of `kubectl apply`, since neither the
+// Kubernetes 1.12 API servers the operator supports nor controller-runtime
+// v0.1.8 provide server-side apply. Built w/ the serversideapply tag (which
+// needs controller-runtime v0.2 or later, and Kubernetes 1.16 or later),
+// the object is applied server-side instead, by FieldManager, and the API
+// server tracks which fields each manager owns. Fields defaulted by the API
+// server, or set in the status, don't cause changes.
+//
+// If someone else has changed fields that the operator owns, the object has
+// drifted. The drift is listed in ProcedureStatus.Drift and handled
+// according to the DriftPolicy in ctx (see WithDriftPolicy): by default, the
+// Action is False, naming the drifted fields, which are left alone while the
+// other fields are still applied; w/ DriftCorrect, the fields are changed
+// back. W/ server-side apply, the drifted fields are those that the API
+// server reports as conflicts, i.e. that other managers have changed, and
+// DriftCorrect forces the operator's ownership of them. The data of Secrets
+// is only recorded in LastAppliedAnnotation as hashes.
+//
+// The Action is True once the object's own status shows it is rolled out
+// (for Deployments, StatefulSets and DaemonSets; other objects are rolled out
+// once they match). The Action has a check, so it can be planned, and a
+// cleanup that deletes the object. Both may be replaced w/ options. If the
+// Action is Disruptive, only updates use the disruption budget: creating the
+// object or waiting for its rollout don't.
+func EnsureObject(name string, prereqs []*Action, desired DesiredFunc, options ...ActionOption) *Action {
+	e := ensurer{name: name, desired: desired}
+	options = append([]ActionOption{WithCheck(e.check), WithCleanup(e.cleanup)}, options...)
+	return NewAction(name, prereqs, e.apply, options...)
+}
+
+// ensurer implements the functions of an EnsureObject Action
+type ensurer struct {
+	name    string
+	desired DesiredFunc
+}
+
+// object returns the desired object, w/ its controller set, and the
+// existing object, or nil if it doesn't exist
+func (e ensurer) object(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (runtime.Object, runtime.Object, error) {
+	obj, owner, err := e.desired(ctx, request, client, scheme)
+	if err != nil {
+		return nil, nil, err
+	}
+	if owner != nil {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := controllerutil.SetControllerReference(owner, accessor, scheme); err != nil {
+			return nil, nil, err
+		}
+	}
+	existing := obj.DeepCopyObject()
+	if err := client.Get(ctx, keyOf(obj), existing); err != nil {
+		if errors.IsNotFound(err) {
+			return obj, nil, nil
+		}
+		return nil, nil, err
+	}
+	return obj, existing, nil
+}
+
+// check compares the object to the desired one w/o making changes
+func (e ensurer) check(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (Result, error) {
+	policy, err := driftPolicyFrom(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	obj, existing, err := e.object(ctx, request, client, scheme)
+	if err != nil {
+		return Result{}, err
+	}
+	if existing == nil {
+		return Result{
+			Status:        corev1.ConditionUnknown,
+			Message:       fmt.Sprintf("%s would be created", describeObject(obj)),
+			NonDisruptive: true,
+		}, nil
+	}
+	applied, drift, err := merge(obj, existing, policy == DriftCorrect)
+	switch {
+	case err != nil:
+		return Result{}, err
+	case applied == nil && drift != nil:
+		return Result{Status: corev1.ConditionFalse, Message: drift.String()}, nil
+	case drift != nil && policy == DriftCorrect:
+		return Result{
+			Status:  corev1.ConditionUnknown,
+			Message: fmt.Sprintf("%s has drifted and would be corrected (%s)", drift.Object, drift.fieldList()),
+		}, nil
+	case drift != nil:
+		return Result{
+			Status:  corev1.ConditionUnknown,
+			Message: fmt.Sprintf("%s has drifted (%s), and its other fields would be updated", drift.Object, drift.fieldList()),
+		}, nil
+	case applied != nil:
+		return Result{Status: corev1.ConditionUnknown, Message: fmt.Sprintf("%s would be updated", describeObject(obj))}, nil
+	}
+	// Only waiting for a rollout doesn't disrupt the system any further
+	result := rollout(existing)
+	result.NonDisruptive = true
+	return result, nil
+}
+
+// apply creates or updates the object as needed
+func (e ensurer) apply(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (Result, error) {
+	policy, err := driftPolicyFrom(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	obj, existing, err := e.object(ctx, request, client, scheme)
+	if err != nil {
+		return Result{}, err
+	}
+	if serverSideApply != nil {
+		return serverSideApply(e, ctx, obj, existing, policy, client, scheme)
+	}
+	if existing == nil {
+		if err := setLastApplied(obj); err != nil {
+			return Result{}, err
+		}
+		if err := client.Create(ctx, obj); err != nil {
+			return Result{}, err
+		}
+		return Result{
+			Status:       corev1.ConditionUnknown,
+			Message:      fmt.Sprintf("created %s", describeObject(obj)),
+			RequeueAfter: RolloutRequeueAfter,
+		}, nil
+	}
+	applied, drift, err := merge(obj, existing, policy == DriftCorrect)
+	if err != nil {
+		return Result{}, err
+	}
+	if applied == nil && drift != nil {
+		drift.Action = e.name
+		recordDrift(ctx, *drift)
+		return Result{Status: corev1.ConditionFalse, Message: drift.String()}, nil
+	}
+	if applied == nil {
+		return rollout(existing), nil
+	}
+	// The resource version of the existing object is kept, so the update
+	// fails if the object has changed since it was read
+	if err := client.Update(ctx, applied); err != nil {
+		return Result{}, err
+	}
+	message := fmt.Sprintf("updated %s", describeObject(obj))
+	if drift != nil {
+		drift.Action = e.name
+		drift.Corrected = policy == DriftCorrect
+		recordDrift(ctx, *drift)
+		if !drift.Corrected {
+			// The other fields were updated, but the object still
+			// differs from the desired one
+			return Result{Status: corev1.ConditionFalse, Message: drift.String()}, nil
+		}
+		message = drift.String()
+	}
+	return Result{
+		Status:       corev1.ConditionUnknown,
+		Message:      message,
+		RequeueAfter: RolloutRequeueAfter,
+	}, nil
+}
+
+// cleanup deletes the object, and is True once it is gone
+func (e ensurer) cleanup(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (Result, error) {
+	obj, _, err := e.desired(ctx, request, client, scheme)
+	if err != nil {
+		return Result{}, err
+	}
+	existing := obj.DeepCopyObject()
+	if err := client.Get(ctx, keyOf(obj), existing); err != nil {
+		if errors.IsNotFound(err) {
+			return Result{Status: corev1.ConditionTrue, Message: fmt.Sprintf("%s is gone", describeObject(obj))}, nil
+		}
+		return Result{}, err
+	}
+	if err := client.Delete(ctx, existing); err != nil && !errors.IsNotFound(err) {
+		return Result{}, err
+	}
+	return Result{
+		Status:       corev1.ConditionUnknown,
+		Message:      fmt.Sprintf("deleting %s", describeObject(obj)),
+		RequeueAfter: RolloutRequeueAfter,
+	}, nil
+}
+
+// merge returns the existing object w/ the desired object applied to it, or
+// nil if that makes no difference. The fields set in the desired object are
+// merged into the existing object, and those that were last applied but are
+// no longer desired are removed. If fields that the operator owns have been
+// changed by someone else, the drift is returned too, and they are only
+// changed back if overwrite is true. Otherwise, the other fields are still
+// applied, and the drifted ones keep their last applied configuration in
+// LastAppliedAnnotation, so that they are reported until they are changed
+// back or the policy is changed.
+func merge(obj, existing runtime.Object, overwrite bool) (runtime.Object, *Drift, error) {
+	modified, err := configOf(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	recorded, err := recordedConfig(obj, modified)
+	if err != nil {
+		return nil, nil, err
+	}
+	em, err := meta.Accessor(existing)
+	if err != nil {
+		return nil, nil, err
+	}
+	lastApplied := em.GetAnnotations()[LastAppliedAnnotation]
+	// The annotation is managed separately, so that a new configuration
+	// doesn't conflict w/ the previous one
+	current := existing.DeepCopyObject()
+	if err := removeLastApplied(current); err != nil {
+		return nil, nil, err
+	}
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return nil, nil, err
+	}
+	original, err := originalConfig(obj, lastApplied, currentJSON)
+	if err != nil {
+		return nil, nil, err
+	}
+	lookup, err := strategicpatch.NewPatchMetaFromStruct(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	patch, err := strategicpatch.CreateThreeWayMergePatch(original, modified, currentJSON, lookup, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	appliedJSON, err := strategicpatch.StrategicMergePatch(currentJSON, patch, obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	if same, err := sameJSON(appliedJSON, currentJSON); err != nil || (same && lastApplied == string(recorded)) {
+		return nil, nil, err
+	}
+	// W/o a record of the fields it owns, the operator takes them over
+	var drift *Drift
+	if len(original) > 0 {
+		var fields [][]string
+		if drift, fields, err = drifted(original, currentJSON, patch, obj); err != nil {
+			return nil, nil, err
+		}
+		if drift != nil && !overwrite {
+			appliedJSON, recorded, err = keepFields(fields, patch, currentJSON, recorded, lastApplied, obj)
+			if err != nil {
+				return nil, nil, err
+			}
+			same, err := sameJSON(appliedJSON, currentJSON)
+			if err != nil {
+				return nil, nil, err
+			}
+			if same && lastApplied == string(recorded) {
+				return nil, drift, nil
+			}
+		}
+	}
+	applied := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(runtime.Object)
+	if err := json.Unmarshal(appliedJSON, applied); err != nil {
+		return nil, nil, err
+	}
+	am, err := meta.Accessor(applied)
+	if err != nil {
+		return nil, nil, err
+	}
+	setAnnotation(am, LastAppliedAnnotation, string(recorded))
+	return applied, drift, nil
+}
+
+// drifted returns the Drift of the object if the patch changes fields that
+// were changed by someone else since the configuration was last applied, as
+// well as the paths of those fields
+func drifted(lastApplied, current, patch []byte, obj runtime.Object) (*Drift, [][]string, error) {
+	changed, err := strategicpatch.CreateTwoWayMergePatch(lastApplied, current, obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	var patchMap, changedMap map[string]interface{}
+	if err := json.Unmarshal(patch, &patchMap); err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal(changed, &changedMap); err != nil {
+		return nil, nil, err
+	}
+	// The order of lists is not a change of their elements
+	removeElementOrder(patchMap)
+	removeElementOrder(changedMap)
+	lookup, err := strategicpatch.NewPatchMetaFromStruct(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	found, err := strategicpatch.MergingMapsHaveConflicts(patchMap, changedMap, lookup)
+	if err != nil || !found {
+		return nil, nil, err
+	}
+	var fields [][]string
+	overlap(nil, patchMap, changedMap, &fields)
+	drift := &Drift{Object: describeObject(obj)}
+	for _, path := range fields {
+		drift.Fields = append(drift.Fields, strings.Join(path, "."))
+	}
+	sort.Strings(drift.Fields)
+	return drift, fields, nil
+}
+
+// keepFields returns the current object w/ the patch applied, except for the
+// fields at the paths, and the recorded configuration w/ those fields as they
+// were last applied, so that they are left to whoever changed them
+func keepFields(fields [][]string, patch, current, recorded []byte, lastApplied string, obj runtime.Object) ([]byte, []byte, error) {
+	var patchMap, recordedMap, lastAppliedMap map[string]interface{}
+	if err := json.Unmarshal(patch, &patchMap); err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal(recorded, &recordedMap); err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal([]byte(lastApplied), &lastAppliedMap); err != nil {
+		return nil, nil, err
+	}
+	for _, path := range fields {
+		removeField(patchMap, path)
+		copyField(recordedMap, lastAppliedMap, path)
+	}
+	kept, err := json.Marshal(patchMap)
+	if err != nil {
+		return nil, nil, err
+	}
+	applied, err := strategicpatch.StrategicMergePatch(current, kept, obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	if recorded, err = json.Marshal(recordedMap); err != nil {
+		return nil, nil, err
+	}
+	return applied, recorded, nil
+}
+
+// removeField removes the field at the path from a strategic merge patch,
+// along w/ the directives about it
+func removeField(patch map[string]interface{}, path []string) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := patch[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		patch = next
+	}
+	key := path[len(path)-1]
+	delete(patch, key)
+	delete(patch, "$setElementOrder/"+key)
+	delete(patch, "$deleteFromPrimitiveList/"+key)
+}
+
+// copyField sets the field at the path in config to its value in from, or
+// removes it if from doesn't have it
+func copyField(config, from map[string]interface{}, path []string) {
+	for _, key := range path[:len(path)-1] {
+		next, _ := from[key].(map[string]interface{})
+		if _, ok := config[key].(map[string]interface{}); !ok {
+			if next == nil {
+				return
+			}
+			config[key] = make(map[string]interface{})
+		}
+		config, from = config[key].(map[string]interface{}), next
+	}
+	key := path[len(path)-1]
+	if value, ok := from[key]; ok {
+		config[key] = value
+		return
+	}
+	delete(config, key)
+}
+
+// removeElementOrder removes the directives that set the order of lists
+// from a strategic merge patch
+func removeElementOrder(patch map[string]interface{}) {
+	for key, value := range patch {
+		if strings.HasPrefix(key, "$setElementOrder/") {
+			delete(patch, key)
+			continue
+		}
+		if m, ok := value.(map[string]interface{}); ok {
+			removeElementOrder(m)
+		}
+	}
+}
+
+// sameJSON returns true if the JSON documents are equal
+func sameJSON(a, b []byte) (bool, error) {
+	var av, bv interface{}
+	if err := json.Unmarshal(a, &av); err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(b, &bv); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(av, bv), nil
+}
+
+// overlap appends the paths of the fields set in both maps to fields
+func overlap(path []string, a, b map[string]interface{}, fields *[][]string) {
+	for key, av := range a {
+		bv, ok := b[key]
+		if !ok || strings.HasPrefix(key, "$") {
+			continue
+		}
+		name := append(append([]string{}, path...), key)
+		am, aok := av.(map[string]interface{})
+		bm, bok := bv.(map[string]interface{})
+		if aok && bok {
+			overlap(name, am, bm, fields)
+			continue
+		}
+		*fields = append(*fields, name)
+	}
+}
+
+// configOf returns the configuration of the desired object that is applied,
+// i.e. the object w/o its status or server-set metadata
+func configOf(obj runtime.Object) ([]byte, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	delete(config, "status")
+	pruneNullTimestamps(config)
+	if metadata, ok := config["metadata"].(map[string]interface{}); ok {
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			delete(annotations, LastAppliedAnnotation)
+			if len(annotations) == 0 {
+				delete(metadata, "annotations")
+			}
+		}
+	}
+	return json.Marshal(config)
+}
+
+// pruneNullTimestamps removes the creation timestamps that typed objects
+// marshal as null, so they aren't mistaken for fields to be removed
+func pruneNullTimestamps(config map[string]interface{}) {
+	for key, value := range config {
+		switch v := value.(type) {
+		case nil:
+			if key == "creationTimestamp" {
+				delete(config, key)
+			}
+		case map[string]interface{}:
+			pruneNullTimestamps(v)
+		}
+	}
+}
+
+// recordedConfig returns the configuration of the object as recorded in its
+// LastAppliedAnnotation. The data of Secrets is replaced by hashes, so that
+// it isn't exposed.
+func recordedConfig(obj runtime.Object, config []byte) ([]byte, error) {
+	if _, ok := obj.(*corev1.Secret); !ok {
+		return config, nil
+	}
+	var recorded map[string]interface{}
+	if err := json.Unmarshal(config, &recorded); err != nil {
+		return nil, err
+	}
+	if data, ok := recorded["data"].(map[string]interface{}); ok {
+		for key, value := range data {
+			if s, ok := value.(string); ok {
+				data[key] = hashOf(s)
+			}
+		}
+	}
+	return json.Marshal(recorded)
+}
+
+// originalConfig returns the configuration last applied to the object, from
+// its LastAppliedAnnotation. The hashed data of Secrets is replaced by the
+// current data where it matches, so that only data changed by someone else
+// differs.
+func originalConfig(obj runtime.Object, lastApplied string, current []byte) ([]byte, error) {
+	if _, ok := obj.(*corev1.Secret); !ok || lastApplied == "" {
+		return []byte(lastApplied), nil
+	}
+	var original, existing map[string]interface{}
+	if err := json.Unmarshal([]byte(lastApplied), &original); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(current, &existing); err != nil {
+		return nil, err
+	}
+	data, _ := original["data"].(map[string]interface{})
+	existingData, _ := existing["data"].(map[string]interface{})
+	for key, value := range data {
+		if s, ok := existingData[key].(string); ok && hashOf(s) == value {
+			data[key] = s
+		}
+	}
+	return json.Marshal(original)
+}
+
+// hashOf returns the hash of a value for LastAppliedAnnotation
+func hashOf(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// setLastApplied records the configuration of the object in its
+// LastAppliedAnnotation
+func setLastApplied(obj runtime.Object) error {
+	config, err := configOf(obj)
+	if err != nil {
+		return err
+	}
+	recorded, err := recordedConfig(obj, config)
+	if err != nil {
+		return err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	setAnnotation(accessor, LastAppliedAnnotation, string(recorded))
+	return nil
+}
+
+// removeLastApplied removes the LastAppliedAnnotation from the object
+func removeLastApplied(obj runtime.Object) error {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	annotations := accessor.GetAnnotations()
+	if _, ok := annotations[LastAppliedAnnotation]; !ok {
+		return nil
+	}
+	delete(annotations, LastAppliedAnnotation)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	accessor.SetAnnotations(annotations)
+	return nil
+}
+
+func setAnnotation(obj metav1.Object, key, value string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[key] = value
+	obj.SetAnnotations(annotations)
+}
+
+// rollout returns the Result for an existing object that matches the
+// desired one, based on its status
+func rollout(obj runtime.Object) Result {
+	done, message := rolledOut(obj)
+	if !done {
+		return Result{
+			Status:       corev1.ConditionUnknown,
+			Message:      fmt.Sprintf("waiting for rollout of %s: %s", describeObject(obj), message),
+			RequeueAfter: RolloutRequeueAfter,
+		}
+	}
+	return Result{Status: corev1.ConditionTrue, Message: fmt.Sprintf("%s is rolled out", describeObject(obj))}
+}
+
+// rolledOut returns whether the status of the object shows that its
+// current spec is rolled out and, if not, why
+func rolledOut(obj runtime.Object) (bool, string) {
+	replicas := func(r *int32) int32 {
+		if r == nil {
+			return 1
+		}
+		return *r
+	}
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		want := replicas(o.Spec.Replicas)
+		switch {
+		case o.Status.ObservedGeneration < o.Generation:
+			return false, "spec not observed yet"
+		case o.Status.UpdatedReplicas < want:
+			return false, fmt.Sprintf("%d of %d replicas updated", o.Status.UpdatedReplicas, want)
+		case o.Status.AvailableReplicas < want:
+			return false, fmt.Sprintf("%d of %d replicas available", o.Status.AvailableReplicas, want)
+		}
+	case *appsv1.StatefulSet:
+		want := replicas(o.Spec.Replicas)
+		switch {
+		case o.Status.ObservedGeneration < o.Generation:
+			return false, "spec not observed yet"
+		case o.Status.UpdateRevision != "" && o.Status.CurrentRevision != o.Status.UpdateRevision:
+			return false, fmt.Sprintf("%d of %d replicas updated", o.Status.UpdatedReplicas, want)
+		case o.Status.ReadyReplicas < want:
+			return false, fmt.Sprintf("%d of %d replicas ready", o.Status.ReadyReplicas, want)
+		}
+	case *appsv1.DaemonSet:
+		want := o.Status.DesiredNumberScheduled
+		switch {
+		case o.Status.ObservedGeneration < o.Generation:
+			return false, "spec not observed yet"
+		case o.Status.UpdatedNumberScheduled < want:
+			return false, fmt.Sprintf("%d of %d pods updated", o.Status.UpdatedNumberScheduled, want)
+		case o.Status.NumberAvailable < want:
+			return false, fmt.Sprintf("%d of %d pods available", o.Status.NumberAvailable, want)
+		}
+	}
+	return true, ""
+}
+
+// keyOf returns the key of the object
+func keyOf(obj runtime.Object) types.NamespacedName {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return types.NamespacedName{}
+	}
+	return types.NamespacedName{Namespace: accessor.GetNamespace(), Name: accessor.GetName()}
+}
+
+// describeObject returns the kind and key of the object for messages (e.g.,
+// "StatefulSet ns/name")
+func describeObject(obj runtime.Object) string {
+	return fmt.Sprintf("%s %s", reflect.TypeOf(obj).Elem().Name(), keyOf(obj))
+}
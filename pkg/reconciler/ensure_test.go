@@ -0,0 +1,244 @@
+package reconciler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// desiredStatefulSet returns a StatefulSet owned by the ConfigMap named by
+// the request, which has the image to run
+func desiredStatefulSet(ctx context.Context, request reconcile.Request, client client.Client, _ *runtime.Scheme) (runtime.Object, metav1.Object, error) {
+	owner := &corev1.ConfigMap{}
+	if err := client.Get(ctx, request.NamespacedName, owner); err != nil {
+		return nil, nil, err
+	}
+	labels := map[string]string{"app": "ensured"}
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ensured",
+			Namespace: request.Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			ServiceName: "ensured",
+			Selector:    &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "ensured", Image: owner.Data["image"]}},
+				},
+			},
+		},
+	}, owner, nil
+}
+
+func TestEnsureObject(t *testing.T) {
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "owner", Namespace: "namespace"}}
+	owner := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "namespace", UID: "owner-uid"},
+		Data:       map[string]string{"image": "ensured:latest"},
+	}
+	client := fake.NewFakeClient(owner)
+	a := EnsureObject("ensured", []*Action{}, desiredStatefulSet)
+	p := MustNewProcedure(0, 0, []*Action{a})
+	key := types.NamespacedName{Name: "ensured", Namespace: "namespace"}
+	get := func() *appsv1.StatefulSet {
+		ss := &appsv1.StatefulSet{}
+		if err := client.Get(context.TODO(), key, ss); err != nil {
+			t.Fatalf("unable to get the StatefulSet: %v", err)
+		}
+		return ss
+	}
+	set := func(change func(ss *appsv1.StatefulSet), status bool) {
+		ss := get()
+		change(ss)
+		var err error
+		if status {
+			err = client.Status().Update(context.TODO(), ss)
+		} else {
+			err = client.Update(context.TODO(), ss)
+		}
+		if err != nil {
+			t.Fatalf("unable to update the StatefulSet: %v", err)
+		}
+	}
+	setImage := func(image string) {
+		owner.Data["image"] = image
+		if err := client.Update(context.TODO(), owner); err != nil {
+			t.Fatalf("unable to update the owner: %v", err)
+		}
+	}
+	image := func(image string) func(ss *appsv1.StatefulSet) {
+		return func(ss *appsv1.StatefulSet) { ss.Spec.Template.Spec.Containers[0].Image = image }
+	}
+	const conflict = "StatefulSet namespace/ensured has drifted (spec.template.spec.containers)"
+
+	var steps = []struct {
+		name        string
+		change      func(ss *appsv1.StatefulSet)
+		status      bool
+		image       string
+		wantPlan    string
+		wantCond    corev1.ConditionStatus
+		wantMessage string
+	}{
+		{"created", nil, false, "",
+			"StatefulSet namespace/ensured would be created",
+			corev1.ConditionUnknown, "created StatefulSet namespace/ensured"},
+		{"not rolled out", nil, false, "",
+			"waiting for rollout of StatefulSet namespace/ensured: 0 of 1 replicas ready",
+			corev1.ConditionUnknown, "waiting for rollout of StatefulSet namespace/ensured: 0 of 1 replicas ready"},
+		{"rolled out", func(ss *appsv1.StatefulSet) { ss.Status.ReadyReplicas = 1 }, true, "", "",
+			corev1.ConditionTrue, "StatefulSet namespace/ensured is rolled out"},
+		// Fields defaulted by the API server or added by others aren't
+		// drift
+		{"changed by others", func(ss *appsv1.StatefulSet) {
+			ss.Spec.PodManagementPolicy = appsv1.OrderedReadyPodManagement
+			ss.Spec.Template.Spec.Containers[0].TerminationMessagePath = "/dev/termination-log"
+			ss.Spec.Template.Spec.Containers = append(ss.Spec.Template.Spec.Containers,
+				corev1.Container{Name: "debug", Image: "debug:latest"})
+			ss.Labels["other"] = "label"
+			ss.Annotations["other"] = "annotation"
+		}, false, "", "",
+			corev1.ConditionTrue, "StatefulSet namespace/ensured is rolled out"},
+		{"desired changed", nil, false, "new:latest",
+			"StatefulSet namespace/ensured would be updated",
+			corev1.ConditionUnknown, "updated StatefulSet namespace/ensured"},
+		{"applied", nil, false, "", "",
+			corev1.ConditionTrue, "StatefulSet namespace/ensured is rolled out"},
+		{"conflict", image("other:latest"), false, "",
+			conflict, corev1.ConditionFalse, conflict},
+		{"conflict resolved", image("new:latest"), false, "", "",
+			corev1.ConditionTrue, "StatefulSet namespace/ensured is rolled out"},
+	}
+	for _, step := range steps {
+		if step.change != nil {
+			set(step.change, step.status)
+		}
+		if step.image != "" {
+			setImage(step.image)
+		}
+		changes, err := p.Plan(context.TODO(), request, client, scheme.Scheme)
+		if err != nil {
+			t.Fatalf("%s: unexpected error planning: %v", step.name, err)
+		}
+		if (step.wantPlan == "" && len(changes) != 0) || (step.wantPlan != "" && (len(changes) != 1 || changes[0].Message != step.wantPlan)) {
+			t.Errorf("%s: expected plan %q; got %+v", step.name, step.wantPlan, changes)
+		}
+		status, err := p.Execute(context.TODO(), request, client, scheme.Scheme)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		if got := status.Results[0]; got.Status != step.wantCond || got.Message != step.wantMessage {
+			t.Errorf("%s: expected %v %q; got %+v", step.name, step.wantCond, step.wantMessage, got.Result)
+		}
+	}
+
+	// The changes made by others to fields the operator doesn't own survive
+	ss := get()
+	containers := ss.Spec.Template.Spec.Containers
+	if len(containers) != 2 || containers[0].Image != "new:latest" || containers[1].Name != "debug" {
+		t.Errorf("expected the new image and the debug sidecar; got %+v", containers)
+	}
+	if containers[0].TerminationMessagePath == "" || ss.Spec.PodManagementPolicy == "" ||
+		ss.Labels["other"] == "" || ss.Annotations["other"] == "" {
+		t.Errorf("expected the fields set by others to be kept; got %+v", ss)
+	}
+	refs := ss.GetOwnerReferences()
+	if len(refs) != 1 || refs[0].UID != owner.UID || refs[0].Controller == nil || !*refs[0].Controller {
+		t.Errorf("expected the owner to be the controller; got %+v", refs)
+	}
+
+	for _, want := range []string{"deleting StatefulSet", "StatefulSet namespace/ensured is gone"} {
+		status, err := p.Teardown(context.TODO(), request, client, scheme.Scheme)
+		if err != nil {
+			t.Fatalf("unexpected error tearing down: %v", err)
+		}
+		if got := status.Results[0]; !strings.HasPrefix(got.Message, want) {
+			t.Errorf("expected teardown %q; got %+v", want, got.Result)
+		}
+	}
+}
+
+func TestEnsureObjectRemovesFieldsNoLongerDesired(t *testing.T) {
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "owner", Namespace: "namespace"}}
+	owner := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "namespace"},
+		Data:       map[string]string{"image": "ensured:latest"},
+	}
+	withEnv := true
+	desired := func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (runtime.Object, metav1.Object, error) {
+		obj, owner, err := desiredStatefulSet(ctx, request, client, scheme)
+		if withEnv {
+			container := &obj.(*appsv1.StatefulSet).Spec.Template.Spec.Containers[0]
+			container.Env = []corev1.EnvVar{{Name: "DEBUG", Value: "1"}}
+		}
+		return obj, owner, err
+	}
+	p := MustNewProcedure(0, 0, []*Action{EnsureObject("ensured", []*Action{}, desired)})
+	client := fake.NewFakeClient(owner)
+	for _, env := range []bool{true, false} {
+		withEnv = env
+		if _, err := p.Execute(context.TODO(), request, client, scheme.Scheme); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	ss := &appsv1.StatefulSet{}
+	if err := client.Get(context.TODO(), types.NamespacedName{Name: "ensured", Namespace: "namespace"}, ss); err != nil {
+		t.Fatalf("unable to get the StatefulSet: %v", err)
+	}
+	if env := ss.Spec.Template.Spec.Containers[0].Env; len(env) != 0 {
+		t.Errorf("expected the env var that is no longer desired to be removed; got %+v", env)
+	}
+}
+
+func TestRolledOut(t *testing.T) {
+	three := int32(3)
+	var tests = []struct {
+		name string
+		obj  runtime.Object
+		want bool
+	}{
+		{"deployment not observed", &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Generation: 2},
+			Status:     appsv1.DeploymentStatus{ObservedGeneration: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+		}, false},
+		{"deployment updating", &appsv1.Deployment{
+			Spec:   appsv1.DeploymentSpec{Replicas: &three},
+			Status: appsv1.DeploymentStatus{UpdatedReplicas: 2, AvailableReplicas: 3},
+		}, false},
+		{"deployment rolled out", &appsv1.Deployment{
+			Spec:   appsv1.DeploymentSpec{Replicas: &three},
+			Status: appsv1.DeploymentStatus{UpdatedReplicas: 3, AvailableReplicas: 3},
+		}, true},
+		{"statefulset updating", &appsv1.StatefulSet{
+			Status: appsv1.StatefulSetStatus{ReadyReplicas: 1, CurrentRevision: "a", UpdateRevision: "b"},
+		}, false},
+		{"statefulset rolled out", &appsv1.StatefulSet{
+			Status: appsv1.StatefulSetStatus{ReadyReplicas: 1, CurrentRevision: "b", UpdateRevision: "b"},
+		}, true},
+		{"daemonset unavailable", &appsv1.DaemonSet{
+			Status: appsv1.DaemonSetStatus{DesiredNumberScheduled: 2, UpdatedNumberScheduled: 2, NumberAvailable: 1},
+		}, false},
+		{"daemonset rolled out", &appsv1.DaemonSet{
+			Status: appsv1.DaemonSetStatus{DesiredNumberScheduled: 2, UpdatedNumberScheduled: 2, NumberAvailable: 2},
+		}, true},
+		{"other objects", &corev1.ConfigMap{}, true},
+	}
+	for _, tt := range tests {
+		if got, message := rolledOut(tt.obj); got != tt.want {
+			t.Errorf("%s: expected %v; got %v (%s)", tt.name, tt.want, got, message)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package reconciler
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ErrorClass describes how an error returned by an Action should be handled
+type ErrorClass int
+
+const (
+	// Unclassified errors are returned by Procedure.Execute, and the
+	// request is retried by the controller
+	Unclassified ErrorClass = iota
+	// TransientClass errors are expected to clear up on their own. The
+	// Action is reported as corev1.ConditionUnknown and retried with
+	// backoff instead of being returned by Procedure.Execute.
+	TransientClass
+	// TerminalClass errors will not clear up by retrying. Reconciliation
+	// stops until the spec of the CR changes.
+	TerminalClass
+	// InvalidConfigClass errors mean the spec of the CR is invalid.
+	// Reconciliation stops until the spec of the CR changes.
+	InvalidConfigClass
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case TransientClass:
+		return "Transient"
+	case TerminalClass:
+		return "Terminal"
+	case InvalidConfigClass:
+		return "InvalidConfig"
+	}
+	return "Unclassified"
+}
+
+// classifiedError is an error that has been assigned an ErrorClass
+type classifiedError struct {
+	class ErrorClass
+	err   error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+// Cause returns the underlying error
+func (e *classifiedError) Cause() error {
+	return e.err
+}
+
+// Transient marks err as one that should be retried with backoff
+func Transient(err error) error {
+	return &classifiedError{class: TransientClass, err: err}
+}
+
+// Terminal marks err as one that will not be resolved by retrying
+func Terminal(err error) error {
+	return &classifiedError{class: TerminalClass, err: err}
+}
+
+// InvalidConfig marks err as being caused by an invalid CR spec
+func InvalidConfig(err error) error {
+	return &classifiedError{class: InvalidConfigClass, err: err}
+}
+
+// ClassOf returns the ErrorClass of err. Errors from the API server that
+// are known to be temporary (conflicts, timeouts and throttling) are
+// considered transient even if they have not been marked as such.
+func ClassOf(err error) ErrorClass {
+	switch e := err.(type) {
+	case nil:
+		return Unclassified
+	case *classifiedError:
+		return e.class
+	case *ActionError:
+		return ClassOf(e.Err)
+	case Errors:
+		return e.class()
+	}
+	if apierrors.IsConflict(err) || apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) || apierrors.IsTooManyRequests(err) {
+		return TransientClass
+	}
+	return Unclassified
+}
+
+// IsTransient returns true if err should be retried with backoff
+func IsTransient(err error) bool {
+	return ClassOf(err) == TransientClass
+}
+
+// IsTerminal returns true if err will not be resolved by retrying
+func IsTerminal(err error) bool {
+	return ClassOf(err) == TerminalClass
+}
+
+// IsInvalidConfig returns true if err was caused by an invalid CR spec
+func IsInvalidConfig(err error) bool {
+	return ClassOf(err) == InvalidConfigClass
+}
+
+// ActionError is returned by Procedure.Execute to identify the action that
+// failed
+type ActionError struct {
+	// Action is the name of the action that returned the error
+	Action string
+	// Err is the error returned by the action
+	Err error
+}
+
+func (e *ActionError) Error() string {
+	return fmt.Sprintf("action %s failed: %v", e.Action, e.Err)
+}
+
+// Cause returns the error returned by the action
+func (e *ActionError) Cause() error {
+	return e.Err
+}
+
+// Errors is a list of errors, e.g., from all the actions of a Procedure that
+// failed
+type Errors []error
+
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d errors: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// class returns the most severe ErrorClass of the errors. Invalid config is
+// the most severe, followed by terminal, unclassified, then transient.
+func (e Errors) class() ErrorClass {
+	severity := map[ErrorClass]int{
+		TransientClass:     0,
+		Unclassified:       1,
+		TerminalClass:      2,
+		InvalidConfigClass: 3,
+	}
+	worst := TransientClass
+	for _, err := range e {
+		if c := ClassOf(err); severity[c] > severity[worst] {
+			worst = c
+		}
+	}
+	return worst
+}
+
+// Failure records an error that stopped reconciliation of a CR until its
+// spec changes. It is intended to be stored in the status of the CR.
+type Failure struct {
+	// Reason is the ErrorClass of the error
+	Reason string `json:"reason"`
+	// Message describes the error
+	Message string `json:"message"`
+	// SpecHash identifies the spec that caused the failure
+	SpecHash string `json:"specHash"`
+}
+
+// NewFailure returns a Failure for err if it is a terminal or invalid
+// config error, or nil otherwise. spec is the spec of the CR, which is
+// hashed so that a later change to it can be detected.
+func NewFailure(err error, spec interface{}) (*Failure, error) {
+	class := ClassOf(err)
+	if class != TerminalClass && class != InvalidConfigClass {
+		return nil, nil
+	}
+	hash, herr := SpecHash(spec)
+	if herr != nil {
+		return nil, herr
+	}
+	return &Failure{
+		Reason:   class.String(),
+		Message:  err.Error(),
+		SpecHash: hash,
+	}, nil
+}
+
+// Blocks returns true if the Failure applies to the given spec, meaning
+// reconciliation should not be retried.
+func (f *Failure) Blocks(spec interface{}) bool {
+	if f == nil {
+		return false
+	}
+	hash, err := SpecHash(spec)
+	return err == nil && hash == f.SpecHash
+}
+
+// SpecHash returns a hash of the (JSON encoding of the) spec
+func SpecHash(spec interface{}) (string, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	h := fnv.New64a()
+	_, _ = h.Write(data)
+	return fmt.Sprintf("%016x", h.Sum64()), nil
+}
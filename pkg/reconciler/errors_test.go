@@ -0,0 +1,129 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestErrorClasses(t *testing.T) {
+	resource := schema.GroupResource{Group: "operator.gluster.org", Resource: "glusterclusters"}
+	var tests = []struct {
+		err  error
+		want ErrorClass
+	}{
+		{nil, Unclassified},
+		{errGeneric, Unclassified},
+		{Transient(errGeneric), TransientClass},
+		{Terminal(errGeneric), TerminalClass},
+		{InvalidConfig(errGeneric), InvalidConfigClass},
+		{&ActionError{Action: "a", Err: Terminal(errGeneric)}, TerminalClass},
+		{apierrors.NewConflict(resource, "name", errGeneric), TransientClass},
+		{apierrors.NewNotFound(resource, "name"), Unclassified},
+	}
+	for _, test := range tests {
+		if actual := ClassOf(test.err); actual != test.want {
+			t.Errorf("%v -- expected: %v -- got: %v", test.err, test.want, actual)
+		}
+	}
+}
+
+func TestFailureBlocksUntilSpecChanges(t *testing.T) {
+	type spec struct {
+		Drivers []string
+	}
+	failed := spec{Drivers: []string{"unknown"}}
+
+	f, err := NewFailure(InvalidConfig(errors.New("unknown driver")), failed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f == nil || f.Reason != "InvalidConfig" || f.Message != "unknown driver" {
+		t.Fatalf("unexpected failure: %+v", f)
+	}
+	if !f.Blocks(failed) {
+		t.Errorf("failure should block the spec that caused it")
+	}
+	if f.Blocks(spec{Drivers: []string{"gluster-fuse"}}) {
+		t.Errorf("failure should not block a changed spec")
+	}
+
+	if f, _ = NewFailure(Transient(errGeneric), failed); f != nil {
+		t.Errorf("transient errors should not result in a failure")
+	}
+	var none *Failure
+	if none.Blocks(failed) {
+		t.Errorf("nil failure should not block")
+	}
+}
+
+func TestProcedureHandlesErrorClasses(t *testing.T) {
+	failWith := func(err error) ActionFunc {
+		return func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+			return Result{Status: corev1.ConditionFalse, Message: "failed"}, err
+		}
+	}
+	transient := NewAction("transient", []*Action{}, failWith(Transient(errGeneric)))
+	terminal := NewAction("terminal", []*Action{}, failWith(Terminal(errGeneric)))
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "name",
+			Namespace: "namespace",
+		},
+	}
+	client := fake.NewFakeClient()
+	var scheme *runtime.Scheme
+
+	// Transient errors are reported in the status
+	p := MustNewProcedure(1, 1, []*Action{transient, &trueAction})
+	ps, err := p.Execute(context.TODO(), request, client, scheme)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ps.FullyReconciled {
+		t.Errorf("procedure should not be fully reconciled")
+	}
+	if ps.Results[0].Status != corev1.ConditionUnknown || ps.Results[0].Message != "transient error: an error" {
+		t.Errorf("unexpected result for transient error: %+v", ps.Results[0])
+	}
+
+	// Terminal errors are returned
+	p = MustNewProcedure(1, 1, []*Action{terminal, &trueAction})
+	_, err = p.Execute(context.TODO(), request, client, scheme)
+	if !IsTerminal(err) {
+		t.Errorf("expected a terminal error; got: %v", err)
+	}
+	if errs, ok := err.(Errors); !ok || len(errs) != 1 || errs[0].(*ActionError).Action != "terminal" {
+		t.Errorf("error should identify the failed action; got: %v", err)
+	}
+}
+
+func TestErrorsReportMostSevereClass(t *testing.T) {
+	var tests = []struct {
+		errs Errors
+		want ErrorClass
+	}{
+		{Errors{Transient(errGeneric)}, TransientClass},
+		{Errors{Transient(errGeneric), errGeneric}, Unclassified},
+		{Errors{errGeneric, Terminal(errGeneric), Transient(errGeneric)}, TerminalClass},
+		{Errors{InvalidConfig(errGeneric), Terminal(errGeneric)}, InvalidConfigClass},
+	}
+	for _, test := range tests {
+		if actual := ClassOf(test.errs); actual != test.want {
+			t.Errorf("%v -- expected: %v -- got: %v", test.errs, test.want, actual)
+		}
+	}
+	if msg := (Errors{errGeneric, errGeneric}).Error(); msg != "2 errors: an error; an error" {
+		t.Errorf("unexpected message: %s", msg)
+	}
+}
@@ -0,0 +1,147 @@
+package reconciler
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+// Reasons of the Events emitted for action transitions
+const (
+	// ReasonActionSucceeded is used when an action becomes True
+	ReasonActionSucceeded = "ActionSucceeded"
+	// ReasonActionFailed is used when an action becomes False, or returns
+	// an error
+	ReasonActionFailed = "ActionFailed"
+	// ReasonActionPending is used when an action becomes Unknown
+	ReasonActionPending = "ActionPending"
+	// ReasonActionSkipped is used when an action no longer applies to the
+	// CR
+	ReasonActionSkipped = "ActionSkipped"
+	// ReasonDriftDetected is used when an object managed by an action is
+	// found to have drifted, and the drift is only reported
+	ReasonDriftDetected = "DriftDetected"
+	// ReasonDriftCorrected is used when the drift of an object managed by
+	// an action is corrected
+	ReasonDriftCorrected = "DriftCorrected"
+)
+
+// EventRecorder emits Kubernetes Events on a CR when the Results of its
+// actions change between executions. The last Result of each action is
+// remembered, so steady-state reconciles don't emit any Events. It is safe
+// for concurrent use.
+type EventRecorder struct {
+	recorder record.EventRecorder
+	mutex    sync.Mutex
+	// last holds the last Result reported for each action of each CR
+	last map[types.NamespacedName]map[string]Result
+}
+
+// NewEventRecorder returns an EventRecorder that emits Events via recorder
+// (e.g., from manager.GetRecorder)
+func NewEventRecorder(recorder record.EventRecorder) *EventRecorder {
+	return &EventRecorder{
+		recorder: recorder,
+		last:     make(map[types.NamespacedName]map[string]Result),
+	}
+}
+
+// Record emits an Event on obj for each action, or member of a group, whose
+// Result differs from the last one recorded for the CR. An action
+// transitions when its Status changes, or when its Message changes while it
+// is not True (e.g., a new error). previous are the Results stored in the
+// status of the CR, which are used if nothing has been recorded for it yet
+// (e.g., after a restart of the operator).
+func (r *EventRecorder) Record(obj runtime.Object, name types.NamespacedName, previous map[string]Result, results []ActionResult) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	last, ok := r.last[name]
+	if !ok {
+		last = make(map[string]Result)
+		for action, result := range previous {
+			last[action] = result
+		}
+		r.last[name] = last
+	}
+	for _, ar := range flatten(results) {
+		before, seen := last[ar.Name]
+		last[ar.Name] = ar.Result
+		if seen && !transitioned(before, ar.Result) {
+			continue
+		}
+		eventType, reason := classify(ar)
+		from := "none"
+		if seen {
+			from = describe(before)
+		}
+		r.recorder.Event(obj, eventType, reason,
+			fmt.Sprintf("%s changed from %s to %s: %s", ar.Name, from, describe(ar.Result), ar.Message))
+	}
+}
+
+// RecordDrift emits a Warning Event on obj for each drifted object that is
+// corrected, or that is reported and wasn't already listed, w/ the same
+// fields, in previous (the drift stored in the status of the CR).
+func (r *EventRecorder) RecordDrift(obj runtime.Object, previous, drift []Drift) {
+	for _, d := range drift {
+		if d.Corrected {
+			r.recorder.Event(obj, corev1.EventTypeWarning, ReasonDriftCorrected, d.String())
+			continue
+		}
+		if !containsDrift(previous, d) {
+			r.recorder.Event(obj, corev1.EventTypeWarning, ReasonDriftDetected, d.String())
+		}
+	}
+}
+
+// containsDrift returns true if the list has the same drift as d
+func containsDrift(list []Drift, d Drift) bool {
+	for _, other := range list {
+		if reflect.DeepEqual(other, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Forget discards what was recorded for the CR, e.g., once it is deleted
+func (r *EventRecorder) Forget(name types.NamespacedName) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.last, name)
+}
+
+// transitioned returns true if the change from before to after should be
+// reported
+func transitioned(before, after Result) bool {
+	if before.Status != after.Status || before.Skipped != after.Skipped {
+		return true
+	}
+	return after.Status != corev1.ConditionTrue && before.Message != after.Message
+}
+
+// classify returns the type and reason of the Event for an action's result
+func classify(ar ActionResult) (string, string) {
+	switch {
+	case ar.Skipped:
+		return corev1.EventTypeNormal, ReasonActionSkipped
+	case ar.Err != nil || ar.Status == corev1.ConditionFalse:
+		return corev1.EventTypeWarning, ReasonActionFailed
+	case ar.Status == corev1.ConditionTrue:
+		return corev1.EventTypeNormal, ReasonActionSucceeded
+	}
+	return corev1.EventTypeNormal, ReasonActionPending
+}
+
+// describe returns the state of a Result for use in Event messages
+func describe(result Result) string {
+	if result.Skipped {
+		return "Skipped"
+	}
+	return string(result.Status)
+}
@@ -0,0 +1,118 @@
+package reconciler
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+// drain returns the Events emitted so far by the fake recorder
+func drain(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case e := <-recorder.Events:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestEventsOnTransitions(t *testing.T) {
+	fake := record.NewFakeRecorder(100)
+	events := NewEventRecorder(fake)
+	obj := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "name", Namespace: "namespace"}}
+	name := types.NamespacedName{Name: "name", Namespace: "namespace"}
+	// As stored in the status of the CR by a previous instance of the
+	// operator
+	previous := map[string]Result{
+		"etcd":  {Status: corev1.ConditionFalse, Message: "waiting for pods"},
+		"nodes": {Status: corev1.ConditionTrue, Message: "it's true"},
+	}
+
+	var steps = []struct {
+		results  []ActionResult
+		expected []string
+	}{
+		{
+			[]ActionResult{
+				{Name: "etcd", Result: Result{Status: corev1.ConditionTrue, Message: "ready"}},
+				{Name: "nodes", Result: Result{Status: corev1.ConditionTrue, Message: "it's true"}},
+				{Name: "csi", Result: Result{Status: corev1.ConditionUnknown, Message: "starting"}},
+			},
+			[]string{
+				"Normal ActionSucceeded etcd changed from False to True: ready",
+				"Normal ActionPending csi changed from none to Unknown: starting",
+			},
+		},
+		// Steady state
+		{
+			[]ActionResult{
+				{Name: "etcd", Result: Result{Status: corev1.ConditionTrue, Message: "still ready"}},
+				{Name: "nodes", Result: Result{Status: corev1.ConditionTrue, Message: "it's true"}},
+				{Name: "csi", Result: Result{Status: corev1.ConditionUnknown, Message: "starting"}},
+			},
+			nil,
+		},
+		// A new error, w/o a change of status
+		{
+			[]ActionResult{
+				{Name: "etcd", Result: Result{Status: corev1.ConditionTrue, Message: "ready"}},
+				{Name: "nodes", Result: Result{Status: corev1.ConditionTrue, Message: "it's true"}},
+				{Name: "csi", Result: Result{Status: corev1.ConditionUnknown, Message: "error: boom"}, Err: errGeneric},
+			},
+			[]string{
+				"Warning ActionFailed csi changed from Unknown to Unknown: error: boom",
+			},
+		},
+		{
+			[]ActionResult{
+				{Name: "etcd", Result: Result{Status: corev1.ConditionTrue, Message: "ready"}},
+				{Name: "nodes", Result: Result{Status: corev1.ConditionFalse, Message: "node lost"}},
+				{Name: "csi", Result: Result{Status: corev1.ConditionUnknown, Message: "error: boom"}, Err: errGeneric},
+			},
+			[]string{
+				"Warning ActionFailed nodes changed from True to False: node lost",
+			},
+		},
+	}
+	// The action no longer applies to the CR
+	steps = append(steps, struct {
+		results  []ActionResult
+		expected []string
+	}{
+		[]ActionResult{
+			{Name: "etcd", Result: Result{Status: corev1.ConditionTrue, Message: "ready"}},
+			{Name: "nodes", Result: Result{Status: corev1.ConditionFalse, Message: "node lost"}},
+			{Name: "csi", Result: Result{Status: corev1.ConditionTrue, Message: "action does not apply", Skipped: true}},
+		},
+		[]string{
+			"Normal ActionSkipped csi changed from Unknown to Skipped: action does not apply",
+		},
+	})
+	for i, step := range steps {
+		events.Record(obj, name, previous, step.results)
+		got := drain(fake)
+		if len(got) != len(step.expected) {
+			t.Errorf("step %d: expected events %q; got %q", i, step.expected, got)
+			continue
+		}
+		for j := range got {
+			if got[j] != step.expected[j] {
+				t.Errorf("step %d: expected events %q; got %q", i, step.expected, got)
+				break
+			}
+		}
+	}
+
+	// Once forgotten, the status of the CR is used again
+	events.Forget(name)
+	events.Record(obj, name, previous, steps[0].results)
+	if got := drain(fake); len(got) != 2 {
+		t.Errorf("expected 2 events after Forget; got %q", got)
+	}
+}
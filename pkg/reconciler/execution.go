@@ -0,0 +1,307 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// execution holds the state of a single run of a Procedure (or of a single
+// Action). It records the outcome of each Action so that an Action that is
+// the prereq of several others is only executed once per run. Since the
+// state lives here instead of in the Actions, multiple executions may
+// proceed concurrently using the same Actions.
+type execution struct {
+	ctx     context.Context
+	request reconcile.Request
+	client  client.Client
+	scheme  *runtime.Scheme
+
+	// nodes is the graph of Actions being executed
+	nodes map[*Action]*node
+	// values are the Values published by the Actions
+	values *valueStore
+	// phase is the part of the Actions to run
+	phase phase
+	// kind and version label the metrics of the execution
+	kind    string
+	version string
+	// tracer records spans, if enabled
+	tracer *tracer
+	// budgetUse tracks the use of the disruption budget, if any
+	budgetUse *budgetUse
+	// drift collects the drift found by the Actions, if set
+	drift *driftLog
+}
+
+// node tracks the progress of a single Action within an execution
+type node struct {
+	action *Action
+	// waiting is the number of prereqs that have yet to complete
+	waiting int
+	// prereqs are the nodes that must complete before this one
+	prereqs []*node
+	// dependents are the nodes that have this node as a prereq
+	dependents []*node
+	// done is true once the result and err are valid
+	done   bool
+	result Result
+	err    error
+	// blocked is true if the Action wasn't run because of its prereqs
+	blocked bool
+	// transient is true if the Action returned a transient error, which
+	// is reported in the result instead of err
+	transient bool
+	// spanID identifies the span of the node, if traced
+	spanID string
+}
+
+// completion is sent by a worker once it has finished running an Action
+type completion struct {
+	node   *node
+	result Result
+	err    error
+	// blocked and transient are those of the node
+	blocked   bool
+	transient bool
+	// start and end are when the Action ran
+	start time.Time
+	end   time.Time
+}
+
+func newExecution(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) *execution {
+	return &execution{
+		ctx:     ctx,
+		request: request,
+		client:  client,
+		scheme:  scheme,
+		nodes:   make(map[*Action]*node),
+		values:  newValueStore(),
+		phase:   applyPhase,
+		kind:    kindFrom(ctx),
+		tracer:  newTracer(ctx),
+	}
+}
+
+// add places the Action and all of its (transitive) prereqs into the graph
+func (e *execution) add(a *Action) *node {
+	if n, ok := e.nodes[a]; ok {
+		return n
+	}
+	n := &node{action: a}
+	e.nodes[a] = n
+	seen := make(map[*Action]bool)
+	for _, prereq := range a.prereqs {
+		// A prereq that is listed twice only needs to complete once
+		if seen[prereq] {
+			continue
+		}
+		seen[prereq] = true
+		p := e.add(prereq)
+		p.dependents = append(p.dependents, n)
+		n.prereqs = append(n.prereqs, p)
+		n.waiting++
+	}
+	return n
+}
+
+// reverse reverses the graph so that each Action completes only after all
+// of its dependents have. This is used to tear down in reverse order.
+func (e *execution) reverse() {
+	for _, n := range e.nodes {
+		n.prereqs, n.dependents = n.dependents, n.prereqs
+		n.waiting = len(n.prereqs)
+	}
+}
+
+// execute runs the Actions, and all their prereqs, using up to workers
+// concurrent goroutines. An Action is started only once all of its prereqs
+// have completed. execute returns once all Actions have completed, or, if
+// the execution's context is cancelled, once all started Actions have
+// completed.
+//
+// All action dependencies MUST be expressed via prereqs. To enforce that,
+// the order in which ready Actions are started is intentionally random,
+// unless the context has a Scheduler.
+func (e *execution) execute(actions []*Action, workers int) {
+	scheduler := schedulerFrom(e.ctx)
+	if workers < 1 || scheduler != nil {
+		workers = 1
+	}
+	for _, a := range actions {
+		e.add(a)
+	}
+	if e.phase == cleanupPhase {
+		e.reverse()
+	}
+
+	var ready []*node
+	for _, n := range e.nodes {
+		if n.waiting == 0 {
+			ready = append(ready, n)
+		}
+	}
+	if scheduler == nil {
+		rand.Shuffle(len(ready), func(i, j int) {
+			ready[i], ready[j] = ready[j], ready[i]
+		})
+	}
+
+	completions := make(chan completion)
+	running := 0
+	stopped := false
+	complete := func(c completion) {
+		c.node.done = true
+		c.node.result, c.node.err = c.result, c.err
+		c.node.blocked, c.node.transient = c.blocked, c.transient
+		e.tracer.endAction(c.node, c.start, c.end)
+		if scheduler != nil {
+			scheduler.Completed(c.node.action, c.result, c.err)
+		}
+		for _, d := range c.node.dependents {
+			d.waiting--
+			if d.waiting == 0 {
+				ready = append(ready, d)
+				if scheduler == nil {
+					// Insert at a random position to keep the
+					// order of independent Actions unpredictable
+					i := rand.Intn(len(ready))
+					ready[i], ready[len(ready)-1] = ready[len(ready)-1], ready[i]
+				}
+			}
+		}
+	}
+
+	for {
+		for !stopped && running < workers && len(ready) > 0 {
+			var n *node
+			n, ready = next(scheduler, ready)
+			// Groups complete w/ the aggregate Result of their
+			// members, except when cleaning up since they don't
+			// create anything themselves
+			if n.action.group && e.phase != cleanupPhase {
+				now := time.Now()
+				result := aggregate(n.prereqs)
+				if e.phase == applyPhase {
+					e.observeResult(n.action, describe(result))
+				}
+				complete(completion{node: n, result: result, start: now, end: now})
+				continue
+			}
+			// Actions w/ unmet prereqs complete immediately, w/o
+			// occupying a worker
+			if result, ok := e.prereqsMet(n); !ok {
+				now := time.Now()
+				if e.phase == applyPhase {
+					e.observeResult(n.action, blockedStatus)
+				}
+				complete(completion{node: n, result: result, blocked: true, start: now, end: now})
+				continue
+			}
+			running++
+			go func(n *node) {
+				ctx := withDriftLog(withBudgetUse(withValueScope(e.ctx, n.action, e.values), e.budgetUse), e.drift)
+				start := time.Now()
+				result, err := n.action.run(ctx, e.phase, e.request, e.client, e.scheme)
+				transient := IsTransient(err)
+				result, err = reportError(result, err)
+				if e.phase == applyPhase {
+					e.observeAction(n.action, start, result)
+				}
+				completions <- completion{node: n, result: result, err: err, transient: transient, start: start, end: time.Now()}
+			}(n)
+		}
+		if running == 0 {
+			return
+		}
+		complete(<-completions)
+		running--
+		if e.ctx.Err() != nil {
+			stopped = true
+		}
+	}
+}
+
+// reportError returns the Result to report for an action that returned
+// result and err, and the error to keep, if any. Errors are reported in the
+// Result so that the failure shows up in the status. Transient errors are
+// only reported; backoff takes care of retrying.
+func reportError(result Result, err error) (Result, error) {
+	switch {
+	case err == nil:
+		return result, nil
+	case IsTransient(err):
+		return Result{
+			Status:       corev1.ConditionUnknown,
+			Message:      fmt.Sprintf("transient error: %v", err),
+			RequeueAfter: result.RequeueAfter,
+		}, nil
+	}
+	reported := Result{
+		Status:       corev1.ConditionUnknown,
+		Message:      fmt.Sprintf("error: %v", err),
+		RequeueAfter: result.RequeueAfter,
+	}
+	if class := ClassOf(err); class == TerminalClass || class == InvalidConfigClass {
+		reported.Status = corev1.ConditionFalse
+	}
+	return reported, err
+}
+
+// endTrace exports the span of the Procedure being executed, if traced
+func (e *execution) endTrace(start time.Time, status *ProcedureStatus, err error) {
+	if e.tracer == nil {
+		return
+	}
+	attributes := map[string]string{
+		"kind":      e.kind,
+		"version":   e.version,
+		"phase":     e.phase.String(),
+		"namespace": e.request.Namespace,
+		"name":      e.request.Name,
+	}
+	if status != nil {
+		attributes["fullyReconciled"] = strconv.FormatBool(status.FullyReconciled)
+	}
+	if err != nil {
+		attributes["error"] = err.Error()
+	}
+	e.tracer.endRoot(start, attributes)
+}
+
+// prereqsMet checks whether all of the node's prereqs completed
+// successfully. If not, it returns the Result to use for the node.
+func (e *execution) prereqsMet(n *node) (Result, bool) {
+	// Walk through the prereqs; stop and return corev1.ConditionUnknown if a prereq doesn't return corev1.ConditionTrue
+	for _, prereq := range n.prereqs {
+		if prereq.err != nil || prereq.result.Status != corev1.ConditionTrue {
+			format := "prequisite %s not met"
+			if e.phase == cleanupPhase {
+				format = "dependent %s not cleaned up"
+			}
+			return Result{
+				Status:  corev1.ConditionUnknown,
+				Message: fmt.Sprintf(format, prereq.action.Name),
+			}, false
+		}
+	}
+	return Result{}, true
+}
+
+// completed returns the node of the Action if it completed during this
+// execution, or nil if it did not. Unless the execution was cancelled, all
+// Actions complete.
+func (e *execution) completed(a *Action) *node {
+	n, ok := e.nodes[a]
+	if !ok || !n.done {
+		return nil
+	}
+	return n
+}
@@ -0,0 +1,41 @@
+package reconciler
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HasFinalizer returns true if the object has the named finalizer
+func HasFinalizer(obj metav1.Object, name string) bool {
+	for _, f := range obj.GetFinalizers() {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AddFinalizer adds the named finalizer to the object, if it isn't already
+// present. It returns true if the object was changed.
+func AddFinalizer(obj metav1.Object, name string) bool {
+	if HasFinalizer(obj, name) {
+		return false
+	}
+	obj.SetFinalizers(append(obj.GetFinalizers(), name))
+	return true
+}
+
+// RemoveFinalizer removes the named finalizer from the object. It returns
+// true if the object was changed.
+func RemoveFinalizer(obj metav1.Object, name string) bool {
+	var finalizers []string
+	for _, f := range obj.GetFinalizers() {
+		if f != name {
+			finalizers = append(finalizers, f)
+		}
+	}
+	if len(finalizers) == len(obj.GetFinalizers()) {
+		return false
+	}
+	obj.SetFinalizers(finalizers)
+	return true
+}
@@ -0,0 +1,30 @@
+package reconciler
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFinalizers(t *testing.T) {
+	const name = "example.com/cleanup"
+	obj := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Finalizers: []string{"other"}},
+	}
+	if HasFinalizer(obj, name) {
+		t.Errorf("finalizer should not be present")
+	}
+	if !AddFinalizer(obj, name) || !HasFinalizer(obj, name) {
+		t.Errorf("finalizer should have been added: %v", obj.Finalizers)
+	}
+	if AddFinalizer(obj, name) || len(obj.Finalizers) != 2 {
+		t.Errorf("finalizer should only be added once: %v", obj.Finalizers)
+	}
+	if !RemoveFinalizer(obj, name) || HasFinalizer(obj, name) {
+		t.Errorf("finalizer should have been removed: %v", obj.Finalizers)
+	}
+	if RemoveFinalizer(obj, name) || len(obj.Finalizers) != 1 || obj.Finalizers[0] != "other" {
+		t.Errorf("other finalizers should be kept: %v", obj.Finalizers)
+	}
+}
@@ -0,0 +1,90 @@
+package reconciler
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NewGroup returns an Action that groups the members, e.g., a sequence of
+// Actions shared by several Procedures. The group has no function of its
+// own: once all of its members have completed, its Result is the aggregate
+// of theirs. It is True once all members are True (or skipped), False if any
+// member is False, and Unknown otherwise. A group may be used anywhere an
+// Action can, including as a prereq or as a member of another group. The
+// ActionResult of a group lists the results of its members.
+func NewGroup(name string, members []*Action) *Action {
+	return &Action{
+		Name:    name,
+		prereqs: members,
+		timeout: DefaultActionTimeout,
+		group:   true,
+	}
+}
+
+// aggregate returns the Result of a group from the nodes of its members
+func aggregate(members []*node) Result {
+	result := Result{Status: corev1.ConditionTrue, Skipped: len(members) > 0}
+	var notTrue []string
+	for _, m := range members {
+		result.Skipped = result.Skipped && m.result.Skipped
+		if m.err == nil && m.result.Status == corev1.ConditionTrue {
+			continue
+		}
+		notTrue = append(notTrue, m.action.Name)
+		if m.result.Status == corev1.ConditionFalse {
+			result.Status = corev1.ConditionFalse
+		} else if result.Status != corev1.ConditionFalse {
+			result.Status = corev1.ConditionUnknown
+		}
+	}
+	switch {
+	case len(notTrue) > 0:
+		result.Skipped = false
+		result.Message = fmt.Sprintf("members not True: %s", strings.Join(notTrue, ", "))
+	case result.Skipped:
+		result.Message = "all members were skipped"
+	default:
+		result.Message = fmt.Sprintf("all %d members are True", len(members))
+	}
+	return result
+}
+
+// result returns the ActionResult of the Action, which must have completed.
+// The Result of a group is computed from the final Results of its members
+// since, when cleaning up, the group completes before they do.
+func (e *execution) result(a *Action) ActionResult {
+	n := e.completed(a)
+	ar := ActionResult{
+		Name:      a.Name,
+		Result:    n.result,
+		Err:       n.err,
+		Blocked:   n.blocked,
+		Transient: n.transient,
+	}
+	if !a.group {
+		return ar
+	}
+	var members []*node
+	for _, m := range a.prereqs {
+		members = append(members, e.completed(m))
+		ar.Members = append(ar.Members, e.result(m))
+	}
+	ar.Result = aggregate(members)
+	return ar
+}
+
+// flatten returns the results followed, for each group, by the results of
+// its members. Members are named "<group>/<member>".
+func flatten(results []ActionResult) []ActionResult {
+	var flat []ActionResult
+	for _, ar := range results {
+		flat = append(flat, ar)
+		for _, m := range flatten(ar.Members) {
+			m.Name = ar.Name + "/" + m.Name
+			flat = append(flat, m)
+		}
+	}
+	return flat
+}
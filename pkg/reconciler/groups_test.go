@@ -0,0 +1,141 @@
+package reconciler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestGroupResults(t *testing.T) {
+	never := func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (bool, error) {
+		return false, nil
+	}
+	skipped := NewAction("skipped", []*Action{}, falseAction.action, When(never))
+	var tests = []struct {
+		name        string
+		members     []*Action
+		wantCond    corev1.ConditionStatus
+		wantSkipped bool
+		wantMessage string
+	}{
+		{"all true", []*Action{&trueAction, &countAction}, corev1.ConditionTrue, false, "all 2 members are True"},
+		{"skipped is satisfied", []*Action{&trueAction, skipped}, corev1.ConditionTrue, false, "all 2 members are True"},
+		{"all skipped", []*Action{skipped}, corev1.ConditionTrue, true, "all members were skipped"},
+		{"unknown", []*Action{&trueAction, &unknownAction}, corev1.ConditionUnknown, false, "members not True: unknownAction"},
+		{"error", []*Action{&errorAction, &trueAction}, corev1.ConditionUnknown, false, "members not True: errorAction"},
+		{"false wins", []*Action{&unknownAction, &falseAction}, corev1.ConditionFalse, false, "members not True: unknownAction, falseAction"},
+	}
+	for _, tt := range tests {
+		group := NewGroup("group", tt.members)
+		dependent := NewAction("dependent", []*Action{group}, trueAction.action)
+		p := MustNewProcedure(0, 0, []*Action{group, dependent})
+		client := fake.NewFakeClient()
+		status, _ := p.Execute(context.TODO(), reconcile.Request{}, client, nil)
+
+		got := status.Results[0]
+		if got.Status != tt.wantCond || got.Skipped != tt.wantSkipped || got.Message != tt.wantMessage {
+			t.Errorf("%s: expected %v %q (skipped: %v); got %+v", tt.name, tt.wantCond, tt.wantMessage, tt.wantSkipped, got.Result)
+		}
+		if len(got.Members) != len(tt.members) {
+			t.Fatalf("%s: expected results for %d members; got %+v", tt.name, len(tt.members), got.Members)
+		}
+		for i, m := range tt.members {
+			if got.Members[i].Name != m.Name {
+				t.Errorf("%s: expected member %s; got %+v", tt.name, m.Name, got.Members[i])
+			}
+		}
+		// The group is usable as a prereq
+		wantDependent := corev1.ConditionUnknown
+		if tt.wantCond == corev1.ConditionTrue {
+			wantDependent = corev1.ConditionTrue
+		}
+		if status.Results[1].Status != wantDependent {
+			t.Errorf("%s: expected dependent to be %v; got %+v", tt.name, wantDependent, status.Results[1])
+		}
+	}
+}
+
+func TestNestedGroupsInStatus(t *testing.T) {
+	secret := NewAction("secretResolved", []*Action{}, trueAction.action)
+	tls := NewAction("tlsBuilt", []*Action{secret}, unknownAction.action)
+	credentials := NewGroup("credentials", []*Action{secret, tls})
+	mounted := NewAction("mounted", []*Action{credentials}, trueAction.action)
+	outer := NewGroup("outer", []*Action{credentials, mounted})
+	p := MustNewProcedure(0, 0, []*Action{outer})
+
+	client := fake.NewFakeClient()
+	status, err := p.Execute(context.TODO(), reconcile.Request{}, client, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{
+		"outer=Unknown",
+		"outer/credentials=Unknown",
+		"outer/credentials/secretResolved=True",
+		"outer/credentials/tlsBuilt=Unknown",
+		"outer/mounted=Unknown",
+	}
+	var got []string
+	for _, ar := range flatten(status.Results) {
+		got = append(got, ar.Name+"="+string(ar.Status))
+	}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v; got %v", expected, got)
+	}
+}
+
+func TestGroupTeardown(t *testing.T) {
+	var log cleanupLog
+	crd := NewAction("crd", []*Action{}, trueAction.action, log.cleanup("crd", corev1.ConditionTrue))
+	etcd := NewAction("etcd", []*Action{crd}, trueAction.action, log.cleanup("etcd", corev1.ConditionTrue))
+	group := NewGroup("group", []*Action{crd, etcd})
+	csi := NewAction("csi", []*Action{group}, trueAction.action, log.cleanup("csi", corev1.ConditionFalse))
+	p := MustNewProcedure(0, 0, []*Action{group, csi})
+
+	client := fake.NewFakeClient()
+	status, err := p.Teardown(context.TODO(), reconcile.Request{}, client, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The members wait for the dependents of the group
+	if len(log.names) != 1 || log.names[0] != "csi" {
+		t.Errorf("expected only csi to be cleaned up; got %v", log.names)
+	}
+	if got := status.Results[0]; got.Status != corev1.ConditionUnknown || got.Message != "members not True: crd, etcd" {
+		t.Errorf("unexpected result for the group: %+v", got.Result)
+	}
+}
+
+func TestGroupIsNotPlanned(t *testing.T) {
+	group := NewGroup("group", []*Action{&unknownAction})
+	p := MustNewProcedure(0, 0, []*Action{group})
+	client := fake.NewFakeClient()
+	changes, err := p.Plan(context.TODO(), reconcile.Request{}, client, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Action != unknownAction.Name {
+		t.Errorf("expected only the member to be planned; got %+v", changes)
+	}
+}
+
+func TestGroupDiagrams(t *testing.T) {
+	member := NewAction("member", []*Action{}, trueAction.action)
+	group := NewGroup("group", []*Action{member})
+	dependent := NewAction("dependent", []*Action{group}, trueAction.action)
+	p := MustNewProcedure(0, 0, []*Action{dependent})
+
+	if dot := p.DOT("Groups"); !strings.Contains(dot, `"group" -> "member" [ style=dashed ];`) ||
+		!strings.Contains(dot, `"dependent" -> "group";`) {
+		t.Errorf("unexpected DOT:\n%s", dot)
+	}
+	if mmd := p.Mermaid("Groups"); !strings.Contains(mmd, "a1 -.-> a2") || !strings.Contains(mmd, "a0 --> a1") {
+		t.Errorf("unexpected Mermaid:\n%s", mmd)
+	}
+}
@@ -0,0 +1,98 @@
+package reconciler
+
+import (
+	"reflect"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HistoryLength is the number of entries kept in the history of a CR
+const HistoryLength = 10
+
+// HistoryEntry records what an execution of a Procedure did for a CR,
+// intended to be stored in the status of the CR
+type HistoryEntry struct {
+	// Time is when the execution completed
+	Time metav1.Time `json:"time"`
+	// Version is the version of the Procedure
+	Version int `json:"version"`
+	// Changes are the actions whose results changed
+	Changes []ActionChange `json:"changes,omitempty"`
+	// Errors are the errors returned by the actions
+	Errors []string `json:"errors,omitempty"`
+}
+
+// ActionChange describes the change of an action's result between
+// executions
+type ActionChange struct {
+	// Action is the name of the action, or group member
+	Action string `json:"action"`
+	// From is the previous state of the action, or empty if it had none
+	From string `json:"from,omitempty"`
+	// To is the new state of the action
+	To string `json:"to"`
+	// Message is the message of the new result
+	Message string `json:"message,omitempty"`
+}
+
+// DeepCopyInto copies the receiver into out, for the generated deepcopy
+// functions of the CRs
+func (h *HistoryEntry) DeepCopyInto(out *HistoryEntry) {
+	*out = *h
+	h.Time.DeepCopyInto(&out.Time)
+	if h.Changes != nil {
+		out.Changes = append([]ActionChange{}, h.Changes...)
+	}
+	if h.Errors != nil {
+		out.Errors = append([]string{}, h.Errors...)
+	}
+}
+
+// RecordHistory returns history w/ an entry for the execution of a
+// Procedure appended, keeping the last HistoryLength entries. previous are
+// the Results of the actions before the execution (see ActionResults),
+// status and err are what Execute returned, and version is that of the
+// Procedure. Changes are found as for Events (see EventRecorder.Record).
+// Executions that changed nothing and had no errors, such as steady-state
+// reconciles, are not recorded, so that the history covers what the
+// operator did. Neither are executions that only repeat the errors of the
+// last entry, e.g. while retrying.
+func RecordHistory(history []HistoryEntry, previous map[string]Result, status *ProcedureStatus, err error, version int, now metav1.Time) []HistoryEntry {
+	entry := HistoryEntry{Time: now, Version: version}
+	for _, ar := range flatten(status.Results) {
+		before, seen := previous[ar.Name]
+		if seen && !transitioned(before, ar.Result) {
+			continue
+		}
+		change := ActionChange{Action: ar.Name, To: describe(ar.Result), Message: ar.Message}
+		if seen {
+			change.From = describe(before)
+		}
+		entry.Changes = append(entry.Changes, change)
+	}
+	if errs, ok := err.(Errors); ok {
+		for _, e := range errs {
+			entry.Errors = append(entry.Errors, e.Error())
+		}
+	} else if err != nil {
+		entry.Errors = append(entry.Errors, err.Error())
+	}
+	if len(entry.Changes) == 0 && (len(entry.Errors) == 0 || repeatsErrors(history, entry)) {
+		return history
+	}
+	history = append(history, entry)
+	if len(history) > HistoryLength {
+		history = append([]HistoryEntry{}, history[len(history)-HistoryLength:]...)
+	}
+	return history
+}
+
+// repeatsErrors returns true if the last entry of history has the same
+// errors as entry
+func repeatsErrors(history []HistoryEntry, entry HistoryEntry) bool {
+	if len(history) == 0 {
+		return false
+	}
+	last := history[len(history)-1]
+	return last.Version == entry.Version && reflect.DeepEqual(last.Errors, entry.Errors)
+}
@@ -0,0 +1,74 @@
+package reconciler
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRecordHistory(t *testing.T) {
+	now := metav1.NewTime(time.Date(2018, 11, 1, 3, 0, 0, 0, time.UTC))
+	previous := map[string]Result{
+		"etcd":  {Status: corev1.ConditionUnknown, Message: "waiting for pods"},
+		"nodes": {Status: corev1.ConditionTrue, Message: "it's true"},
+	}
+	errEtcd := &ActionError{Action: "etcd", Err: errors.New("etcd is down")}
+	var tests = []struct {
+		name    string
+		history []HistoryEntry
+		results []ActionResult
+		err     error
+		want    []HistoryEntry
+	}{
+		{"changes", nil, []ActionResult{
+			{Name: "etcd", Result: Result{Status: corev1.ConditionTrue, Message: "ready"}},
+			{Name: "nodes", Result: Result{Status: corev1.ConditionTrue, Message: "still true"}},
+			{Name: "csi", Result: Result{Status: corev1.ConditionUnknown, Message: "starting"}},
+		}, nil, []HistoryEntry{{Time: now, Version: 1, Changes: []ActionChange{
+			{Action: "etcd", From: "Unknown", To: "True", Message: "ready"},
+			{Action: "csi", To: "Unknown", Message: "starting"},
+		}}}},
+		{"steady state", nil, []ActionResult{
+			{Name: "etcd", Result: Result{Status: corev1.ConditionUnknown, Message: "waiting for pods"}},
+			{Name: "nodes", Result: Result{Status: corev1.ConditionTrue, Message: "it's true"}},
+		}, nil, nil},
+		{"errors", nil, []ActionResult{
+			{Name: "etcd", Result: Result{Status: corev1.ConditionUnknown, Message: "waiting for pods"}, Err: errEtcd.Err},
+		}, Errors{errEtcd}, []HistoryEntry{{Time: now, Version: 1, Errors: []string{"action etcd failed: etcd is down"}}}},
+		{"repeated errors", []HistoryEntry{{Version: 1, Errors: []string{"action etcd failed: etcd is down"}}}, []ActionResult{
+			{Name: "etcd", Result: Result{Status: corev1.ConditionUnknown, Message: "waiting for pods"}, Err: errEtcd.Err},
+		}, Errors{errEtcd}, []HistoryEntry{{Version: 1, Errors: []string{"action etcd failed: etcd is down"}}}},
+	}
+	for _, tt := range tests {
+		status := &ProcedureStatus{Results: tt.results}
+		got := RecordHistory(tt.history, previous, status, tt.err, 1, now)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %+v; got %+v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestHistoryIsBounded(t *testing.T) {
+	var history []HistoryEntry
+	for i := 0; i < HistoryLength+5; i++ {
+		status := &ProcedureStatus{Results: []ActionResult{
+			{Name: "a", Result: Result{Status: corev1.ConditionUnknown, Message: fmt.Sprintf("step %d", i)}},
+		}}
+		// W/o previous results, every execution is a change
+		history = RecordHistory(history, nil, status, nil, 1, metav1.Now())
+	}
+	if len(history) != HistoryLength {
+		t.Fatalf("expected %d entries; got %d", HistoryLength, len(history))
+	}
+	if first := history[0].Changes[0].Message; first != "step 5" {
+		t.Errorf("expected the oldest entries to be dropped; got %s first", first)
+	}
+	if last := history[HistoryLength-1].Changes[0].Message; last != fmt.Sprintf("step %d", HistoryLength+4) {
+		t.Errorf("expected the newest entry last; got %s", last)
+	}
+}
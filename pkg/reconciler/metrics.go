@@ -0,0 +1,107 @@
+package reconciler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	actionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "anthill",
+		Subsystem: "reconciler",
+		Name:      "action_duration_seconds",
+		Help:      "Time taken to execute a reconcile action",
+	}, []string{"kind", "version", "action"})
+
+	actionResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "anthill",
+		Subsystem: "reconciler",
+		Name:      "action_results_total",
+		Help:      "Number of reconcile action results, by status (True, False, Unknown, Skipped, or Blocked if the prereqs were not met)",
+	}, []string{"kind", "version", "action", "status"})
+
+	procedureDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "anthill",
+		Subsystem: "reconciler",
+		Name:      "procedure_duration_seconds",
+		Help:      "Time taken to execute a reconcile procedure",
+	}, []string{"kind", "version"})
+
+	unreconciledResources = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "anthill",
+		Subsystem: "reconciler",
+		Name:      "unreconciled_resources",
+		Help:      "Number of custom resources that are not fully reconciled",
+	}, []string{"kind"})
+)
+
+func init() {
+	// Served by the manager at /metrics
+	metrics.Registry.MustRegister(actionDuration, actionResults, procedureDuration, unreconciledResources)
+}
+
+type kindKey struct{}
+
+// WithKind returns a context that causes the metrics of the Procedures and
+// Actions executed with it to be labelled with kind, the kind of CR being
+// reconciled (e.g., GlusterCluster).
+func WithKind(ctx context.Context, kind string) context.Context {
+	return context.WithValue(ctx, kindKey{}, kind)
+}
+
+// kindFrom returns the kind of CR set by WithKind, or "" if there is none
+func kindFrom(ctx context.Context) string {
+	kind, _ := ctx.Value(kindKey{}).(string)
+	return kind
+}
+
+// ForgetMetrics stops counting the CR as unreconciled. It should be called
+// once a CR has been deleted. The kind is taken from ctx (see WithKind).
+func ForgetMetrics(ctx context.Context, name types.NamespacedName) {
+	unreconciled.set(kindFrom(ctx), name, true)
+}
+
+// blockedStatus is the status label of the results of Actions that were not
+// run because their prereqs were not met
+const blockedStatus = "Blocked"
+
+// observeAction records the outcome of an Action executed by e
+func (e *execution) observeAction(a *Action, start time.Time, result Result) {
+	actionDuration.WithLabelValues(e.kind, e.version, a.Name).Observe(time.Since(start).Seconds())
+	e.observeResult(a, describe(result))
+}
+
+// observeResult counts a result of an Action. Actions that don't run, i.e.
+// groups and blocked Actions, only have their results counted, so that their
+// durations don't skew the histogram.
+func (e *execution) observeResult(a *Action, status string) {
+	actionResults.WithLabelValues(e.kind, e.version, a.Name, status).Inc()
+}
+
+// unreconciledSet tracks the CRs of each kind that are not fully reconciled
+type unreconciledSet struct {
+	mutex sync.Mutex
+	names map[string]map[types.NamespacedName]bool
+}
+
+var unreconciled = unreconciledSet{names: make(map[string]map[types.NamespacedName]bool)}
+
+// set records whether the CR is fully reconciled, and updates the gauge
+func (u *unreconciledSet) set(kind string, name types.NamespacedName, reconciled bool) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.names[kind] == nil {
+		u.names[kind] = make(map[types.NamespacedName]bool)
+	}
+	if reconciled {
+		delete(u.names[kind], name)
+	} else {
+		u.names[kind][name] = true
+	}
+	unreconciledResources.WithLabelValues(kind).Set(float64(len(u.names[kind])))
+}
@@ -0,0 +1,109 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// metricValue returns the value of the metric w/ the given name and labels
+// from the controller-runtime registry, and false if it wasn't found. For
+// histograms, the value is the number of observations.
+func metricValue(t *testing.T, name string, labels map[string]string) (float64, bool) {
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("unable to gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if !hasLabels(m, labels) {
+				continue
+			}
+			switch {
+			case m.Counter != nil:
+				return m.Counter.GetValue(), true
+			case m.Gauge != nil:
+				return m.Gauge.GetValue(), true
+			case m.Histogram != nil:
+				return float64(m.Histogram.GetSampleCount()), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func hasLabels(m *dto.Metric, labels map[string]string) bool {
+	matched := 0
+	for _, pair := range m.GetLabel() {
+		if value, ok := labels[pair.GetName()]; ok {
+			if value != pair.GetValue() {
+				return false
+			}
+			matched++
+		}
+	}
+	return matched == len(labels)
+}
+
+func TestProcedureMetrics(t *testing.T) {
+	blocked := NewAction("blockedAction", []*Action{&tfAction}, trueAction.action)
+	group := NewGroup("groupAction", []*Action{&trueAction})
+	p := MustNewProcedure(0, 42, []*Action{&trueAction, &tfAction, blocked, group})
+	ctx := WithKind(context.TODO(), "MetricsTest")
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "name", Namespace: "namespace"}}
+	other := reconcile.Request{NamespacedName: types.NamespacedName{Name: "other", Namespace: "namespace"}}
+	client := fake.NewFakeClient()
+
+	for _, r := range []reconcile.Request{request, request, other} {
+		if _, err := p.Execute(ctx, r, client, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	labels := map[string]string{"kind": "MetricsTest", "version": "42"}
+	checks := []struct {
+		name   string
+		labels map[string]string
+		want   float64
+	}{
+		{"anthill_reconciler_procedure_duration_seconds", labels, 3},
+		{"anthill_reconciler_action_duration_seconds",
+			map[string]string{"kind": "MetricsTest", "version": "42", "action": "TruePrereqsFalseAction"}, 3},
+		// trueAction is both a procedure-level action and a prereq, but
+		// it only runs once per execution
+		{"anthill_reconciler_action_results_total",
+			map[string]string{"kind": "MetricsTest", "version": "42", "action": "trueAction", "status": "True"}, 3},
+		{"anthill_reconciler_action_results_total",
+			map[string]string{"kind": "MetricsTest", "version": "42", "action": "TruePrereqsFalseAction", "status": "False"}, 3},
+		// Actions that don't run are counted, but not timed
+		{"anthill_reconciler_action_results_total",
+			map[string]string{"kind": "MetricsTest", "version": "42", "action": "blockedAction", "status": "Blocked"}, 3},
+		{"anthill_reconciler_action_results_total",
+			map[string]string{"kind": "MetricsTest", "version": "42", "action": "groupAction", "status": "True"}, 3},
+		{"anthill_reconciler_unreconciled_resources", map[string]string{"kind": "MetricsTest"}, 2},
+	}
+	for _, check := range checks {
+		got, ok := metricValue(t, check.name, check.labels)
+		if !ok || got != check.want {
+			t.Errorf("%s%v: expected %v; got %v (found: %v)", check.name, check.labels, check.want, got, ok)
+		}
+	}
+
+	if _, ok := metricValue(t, "anthill_reconciler_action_duration_seconds",
+		map[string]string{"kind": "MetricsTest", "version": "42", "action": "blockedAction"}); ok {
+		t.Error("blocked actions should not be timed")
+	}
+
+	ForgetMetrics(ctx, other.NamespacedName)
+	if got, _ := metricValue(t, "anthill_reconciler_unreconciled_resources", map[string]string{"kind": "MetricsTest"}); got != 1 {
+		t.Errorf("expected 1 unreconciled resource after forgetting one; got %v", got)
+	}
+}
@@ -0,0 +1,99 @@
+package reconciler
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// PlannedChange describes a change that executing a Procedure would make
+type PlannedChange struct {
+	// Action is the name of the action that would make the change
+	Action string `json:"action"`
+	// Message describes the change, as reported by the action's check
+	Message string `json:"message"`
+}
+
+// Plan runs the checks of the Procedure's actions, including prereqs, without
+// applying any of them, and returns the changes that executing the
+// Procedure would make. Actions without a check are assumed to make a
+// change, unless they are ReadOnly, and actions whose prereqs have pending
+// changes are not checked.
+// An empty plan means the system state is fully reconciled. As with Execute,
+// failed checks are returned as an Errors, and cancelling ctx causes Plan to
+// return (nil, ctx.Err()).
+func (p *Procedure) Plan(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) ([]PlannedChange, error) {
+	start := time.Now()
+	run := p.newExecution(ctx, planPhase, request, client, scheme)
+	run.execute(p.actions, p.Workers())
+
+	if err := ctx.Err(); err != nil {
+		run.endTrace(start, nil, err)
+		return nil, err
+	}
+
+	var changes []PlannedChange
+	var errs Errors
+	for _, a := range p.graph().all() {
+		n := run.completed(a)
+		if a.group {
+			// Groups make no changes of their own
+			continue
+		}
+		if n.err != nil {
+			errs = append(errs, &ActionError{Action: a.Name, Err: n.err})
+		}
+		if n.result.Status != corev1.ConditionTrue {
+			changes = append(changes, PlannedChange{
+				Action:  a.Name,
+				Message: n.result.Message,
+			})
+		}
+	}
+
+	if len(errs) > 0 {
+		run.endTrace(start, nil, errs)
+		return changes, errs
+	}
+	run.endTrace(start, nil, nil)
+	return changes, nil
+}
+
+// PlanTeardown returns the cleanups that Teardown would run, in the order it
+// would start them (i.e., the actions that depend on others first), w/o
+// running any of them
+func (p *Procedure) PlanTeardown() []PlannedChange {
+	g := p.graph()
+	// order lists each action after its prereqs
+	var order []*Action
+	visited := make(map[*Action]bool)
+	var visit func(a *Action)
+	visit = func(a *Action) {
+		if visited[a] {
+			return
+		}
+		visited[a] = true
+		for _, prereq := range g.edges[a] {
+			visit(prereq)
+		}
+		order = append(order, a)
+	}
+	for _, a := range g.all() {
+		visit(a)
+	}
+
+	var changes []PlannedChange
+	for i := len(order) - 1; i >= 0; i-- {
+		if a := order[i]; a.cleanup != nil {
+			changes = append(changes, PlannedChange{
+				Action:  a.Name,
+				Message: "would be cleaned up",
+			})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,174 @@
+package reconciler
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// checkedAction returns an Action whose check returns status, and counts the
+// times its function is applied
+func checkedAction(name string, prereqs []*Action, status corev1.ConditionStatus, applied *int32) *Action {
+	return NewAction(name, prereqs,
+		func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+			atomic.AddInt32(applied, 1)
+			return Result{Status: corev1.ConditionTrue, Message: "applied"}, nil
+		},
+		WithCheck(func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+			if status == corev1.ConditionTrue {
+				return Result{Status: status, Message: "up to date"}, nil
+			}
+			return Result{Status: status, Message: name + " needs changes"}, nil
+		}))
+}
+
+func TestCheckSkipsApply(t *testing.T) {
+	var tests = []struct {
+		status      corev1.ConditionStatus
+		wantApplied int32
+		wantMessage string
+	}{
+		{corev1.ConditionTrue, 0, "up to date"},
+		{corev1.ConditionFalse, 1, "applied"},
+		{corev1.ConditionUnknown, 1, "applied"},
+	}
+	for _, test := range tests {
+		var applied int32
+		a := checkedAction("a", []*Action{}, test.status, &applied)
+		client := fake.NewFakeClient()
+		result, err := a.Execute(context.TODO(), reconcile.Request{}, client, nil)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if applied != test.wantApplied || result.Message != test.wantMessage {
+			t.Errorf("check %s: applied %d times with %q; expected %d times with %q",
+				test.status, applied, result.Message, test.wantApplied, test.wantMessage)
+		}
+	}
+}
+
+func TestPlanDoesNotApply(t *testing.T) {
+	var applied int32
+	current := checkedAction("current", []*Action{}, corev1.ConditionTrue, &applied)
+	stale := checkedAction("stale", []*Action{current}, corev1.ConditionFalse, &applied)
+	dependent := checkedAction("dependent", []*Action{stale}, corev1.ConditionTrue, &applied)
+	unchecked := NewAction("unchecked", []*Action{current},
+		func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+			atomic.AddInt32(&applied, 1)
+			return Result{Status: corev1.ConditionTrue}, nil
+		})
+	p := MustNewProcedure(0, 1, []*Action{dependent, unchecked})
+
+	client := fake.NewFakeClient()
+	changes, err := p.Plan(context.TODO(), reconcile.Request{}, client, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if applied != 0 {
+		t.Errorf("plan applied %d actions", applied)
+	}
+	want := []PlannedChange{
+		{"dependent", "prequisite stale not met"},
+		{"unchecked", "action has no check, so it would be applied"},
+		{"stale", "stale needs changes"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %v; got %v", want, changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d: expected %v; got %v", i, want[i], changes[i])
+		}
+	}
+}
+
+func TestPlanReportsCheckErrors(t *testing.T) {
+	var applied int32
+	failing := NewAction("failing", []*Action{}, trueAction.action,
+		WithCheck(errorAction.action))
+	current := checkedAction("current", []*Action{}, corev1.ConditionTrue, &applied)
+	p := MustNewProcedure(0, 1, []*Action{failing, current})
+
+	client := fake.NewFakeClient()
+	changes, err := p.Plan(context.TODO(), reconcile.Request{}, client, nil)
+	if err == nil || !strings.Contains(err.Error(), "action failing failed") {
+		t.Errorf("expected the check's error; got: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Action != "failing" {
+		t.Errorf("expected only failing to be planned; got %v", changes)
+	}
+}
+
+func TestPlanIsEmptyWhenReconciled(t *testing.T) {
+	var applied int32
+	a := checkedAction("a", []*Action{}, corev1.ConditionTrue, &applied)
+	b := checkedAction("b", []*Action{a}, corev1.ConditionTrue, &applied)
+	p := MustNewProcedure(0, 1, []*Action{b})
+
+	client := fake.NewFakeClient()
+	changes, err := p.Plan(context.TODO(), reconcile.Request{}, client, nil)
+	if err != nil || len(changes) != 0 {
+		t.Errorf("expected an empty plan; got %v, %v", changes, err)
+	}
+}
+
+func TestReadOnlyActionsArePlanned(t *testing.T) {
+	var applied int32
+	valid := NewAction("valid", []*Action{}, trueAction.action, ReadOnly())
+	invalid := NewAction("invalid", []*Action{}, falseAction.action, ReadOnly())
+	a := checkedAction("a", []*Action{valid}, corev1.ConditionTrue, &applied)
+	b := checkedAction("b", []*Action{invalid}, corev1.ConditionTrue, &applied)
+	p := MustNewProcedure(0, 1, []*Action{a, b})
+
+	client := fake.NewFakeClient()
+	changes, err := p.Plan(context.TODO(), reconcile.Request{}, client, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []PlannedChange{
+		{"b", "prequisite invalid not met"},
+		{"invalid", "it's false"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %v; got %v", want, changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d: expected %v; got %v", i, want[i], changes[i])
+		}
+	}
+}
+
+func TestPlanTeardown(t *testing.T) {
+	var log cleanupLog
+	crd := NewAction("crd", []*Action{}, trueAction.action, log.cleanup("crd", corev1.ConditionTrue))
+	etcd := NewAction("etcd", []*Action{crd}, trueAction.action, log.cleanup("etcd", corev1.ConditionTrue))
+	valid := NewAction("valid", []*Action{}, trueAction.action, ReadOnly())
+	csi := NewAction("csi", []*Action{etcd, valid}, trueAction.action, log.cleanup("csi", corev1.ConditionTrue))
+	p := MustNewProcedure(0, 1, []*Action{etcd, csi})
+
+	want := []PlannedChange{
+		{"csi", "would be cleaned up"},
+		{"etcd", "would be cleaned up"},
+		{"crd", "would be cleaned up"},
+	}
+	changes := p.PlanTeardown()
+	if len(changes) != len(want) {
+		t.Fatalf("expected %v; got %v", want, changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d: expected %v; got %v", i, want[i], changes[i])
+		}
+	}
+	if len(log.names) != 0 {
+		t.Errorf("planning the teardown ran cleanups: %v", log.names)
+	}
+}
@@ -1,10 +1,12 @@
 package reconciler
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"math/rand"
 	"sort"
+	"strconv"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -21,15 +23,22 @@ func (pl ProcedureList) Newest() (*Procedure, error) {
 		return nil, fmt.Errorf("empty list of reconcile procedures")
 	}
 
-	// Sort descending by version
-	sort.Slice(pl, func(i, j int) bool {
-		return pl[i].Version() > pl[j].Version()
-	})
-	p := pl[0]
+	p := pl.sorted()[0]
 
 	return &p, nil
 }
 
+// sorted returns a copy of the list, sorted descending by version. The list
+// itself is left untouched since it is shared by concurrent reconciles.
+func (pl ProcedureList) sorted() ProcedureList {
+	sorted := make(ProcedureList, len(pl))
+	copy(sorted, pl)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version() > sorted[j].Version()
+	})
+	return sorted
+}
+
 // NewestCompatible returns the newest Procedure compatible to *version
 // or the newest available one if version is nil.
 func (pl ProcedureList) NewestCompatible(currentVersion *int) (*Procedure, error) {
@@ -40,13 +49,8 @@ func (pl ProcedureList) NewestCompatible(currentVersion *int) (*Procedure, error
 		return nil, errors.New("empty list of reconcile procedures")
 	}
 
-	// Sort descending by version
-	sort.Slice(pl, func(i, j int) bool {
-		return pl[i].Version() > pl[j].Version()
-	})
-
 	// Walk list to find the first that is compatible w/ the currentVersion
-	for _, p := range pl {
+	for _, p := range pl.sorted() {
 		if p.MinVersion() <= *currentVersion {
 			return &p, nil
 		}
@@ -55,21 +59,60 @@ func (pl ProcedureList) NewestCompatible(currentVersion *int) (*Procedure, error
 	return nil, fmt.Errorf("no procedures are compatible with deployed version %d", *currentVersion)
 }
 
+// DefaultWorkers is the number of Actions a Procedure will execute
+// concurrently if not otherwise specified.
+const DefaultWorkers = 4
+
 // Procedure defines the complete "procedure" (the set of Action) necessary to
 // completely reconcile the state.
 type Procedure struct {
 	minVersion int
 	version    int
 	actions    []*Action
+	// workers is the maximum number of Actions to execute concurrently
+	workers int
+	// migration, if set, migrates the system from an older version
+	migration Migration
 }
 
-// NewProcedure is a constructor for Procedure
-func NewProcedure(minVersion, version int, actions []*Action) *Procedure {
-	return &Procedure{
+// ProcedureOption is used to set optional parameters of a Procedure when it
+// is created by NewProcedure.
+type ProcedureOption func(*Procedure)
+
+// WithWorkers sets the maximum number of independent Actions that will be
+// executed concurrently.
+func WithWorkers(workers int) ProcedureOption {
+	return func(p *Procedure) {
+		p.workers = workers
+	}
+}
+
+// NewProcedure is a constructor for Procedure. It returns an error if the
+// graph of actions is not valid (see Validate).
+func NewProcedure(minVersion, version int, actions []*Action, options ...ProcedureOption) (*Procedure, error) {
+	p := &Procedure{
 		minVersion: minVersion,
 		version:    version,
 		actions:    actions,
+		workers:    DefaultWorkers,
+	}
+	for _, option := range options {
+		option(p)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// MustNewProcedure is like NewProcedure, but panics if the Procedure is not
+// valid. It is intended for initializing package-level Procedures.
+func MustNewProcedure(minVersion, version int, actions []*Action, options ...ProcedureOption) *Procedure {
+	p, err := NewProcedure(minVersion, version, actions, options...)
+	if err != nil {
+		panic(err)
 	}
+	return p
 }
 
 // Version is the reconciler version implemented by this Procedure
@@ -77,6 +120,15 @@ func (p *Procedure) Version() int {
 	return p.version
 }
 
+// Workers is the maximum number of Actions the Procedure will execute
+// concurrently
+func (p *Procedure) Workers() int {
+	if p.workers < 1 {
+		return DefaultWorkers
+	}
+	return p.workers
+}
+
 // MinVersion is the minimum reconciler version this Procedure can be used to
 // upgrade from.
 func (p *Procedure) MinVersion() int {
@@ -87,6 +139,16 @@ func (p *Procedure) MinVersion() int {
 type ActionResult struct {
 	Name string
 	Result
+	// Err is the error returned by the action, if any
+	Err error
+	// Blocked is true if the action was not run because its prereqs were
+	// not met
+	Blocked bool
+	// Transient is true if the action returned a transient error, which is
+	// reported in its Result rather than in Err
+	Transient bool
+	// Members are the Results of the members of a group (see NewGroup)
+	Members []ActionResult
 }
 
 // ProcedureStatus is the result of executing a reconcile Procedure
@@ -97,50 +159,91 @@ type ProcedureStatus struct {
 	// FullyReconciled will be true iff the system state was found to be
 	// full reconciled according to the Procedure
 	FullyReconciled bool
+	// RequeueAfter is the earliest requeue hint given by any of the actions
+	// executed, or zero if none gave a hint
+	RequeueAfter time.Duration
+	// WaitingForBudget are the names of the disruptive actions that did not
+	// apply their changes because the disruption budget was used up
+	WaitingForBudget []string
+	// Drift lists the objects managed by EnsureObject actions that were
+	// found to have drifted
+	Drift []Drift
 }
 
-// Execute the reconcile Procedure
-func (p *Procedure) Execute(request reconcile.Request, client client.Client, scheme *runtime.Scheme) (*ProcedureStatus, error) {
-	// All action dependencies MUST be expressed via its prereqs. To enforce
-	// that, we intentionally shuffle the list of actions that define a
-	// Procedure.
-	actions := p.actions
-	rand.Shuffle(len(actions), func(i, j int) {
-		actions[i], actions[j] = actions[j], actions[i]
-	})
+// Execute the reconcile Procedure. Actions whose prereqs have been met are
+// executed concurrently, up to the Procedure's worker limit. An action that
+// fails does not prevent unrelated actions from executing; the returned
+// ProcedureStatus describes all the actions and, if any of them failed, the
+// returned error is an Errors listing each failure. Cancelling ctx abandons
+// any in-flight action and causes Execute to return (nil, ctx.Err()).
+func (p *Procedure) Execute(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (*ProcedureStatus, error) {
+	// All cached action state is scoped to this execution
+	start := time.Now()
+	run := p.newExecution(ctx, applyPhase, request, client, scheme)
+	// The disruptions that ended are over even if the execution is
+	// interrupted
+	defer run.budgetUse.release(ctx)
+	run.execute(p.actions, p.Workers())
+
+	// Stop if we were asked to; the results of any actions that were
+	// interrupted can't be trusted.
+	if err := ctx.Err(); err != nil {
+		run.endTrace(start, nil, err)
+		return nil, err
+	}
 
-	// Clear cached action state
-	for _, step := range actions {
-		// Clear the action's prereqs
-		for _, pre := range step.prereqs {
-			pre.Clear()
-		}
-		// Clear the action
-		step.Clear()
+	status, err := p.status(run)
+	run.endTrace(start, status, err)
+	procedureDuration.WithLabelValues(run.kind, run.version).Observe(time.Since(start).Seconds())
+	unreconciled.set(run.kind, request.NamespacedName, status.FullyReconciled)
+	return status, err
+}
+
+// newExecution returns an execution of the Procedure for the given phase
+func (p *Procedure) newExecution(ctx context.Context, phase phase, request reconcile.Request, client client.Client, scheme *runtime.Scheme) *execution {
+	run := newExecution(ctx, request, client, scheme)
+	run.phase = phase
+	if phase == applyPhase {
+		run.budgetUse = &budgetUse{}
+		run.drift = &driftLog{}
 	}
+	run.version = strconv.Itoa(p.version)
+	run.tracer.startRoot()
+	return run
+}
 
+// status gathers the outcome of an execution of the Procedure. The
+// Procedure is fully reconciled iff every action, including prereqs, has
+// completed w/ corev1.ConditionTrue.
+func (p *Procedure) status(run *execution) (*ProcedureStatus, error) {
 	status := ProcedureStatus{
 		FullyReconciled: true,
 	}
 
-	// Execute the actions
-	for _, step := range actions {
-		result, err := step.Execute(request, client, scheme)
-		if err != nil {
-			return nil, err
+	// Prereqs may have hints and errors too, so consider every action that
+	// ran. They are walked in a fixed order so that the errors are too.
+	var errs Errors
+	for _, a := range p.graph().all() {
+		n := run.completed(a)
+		status.RequeueAfter = earliest(status.RequeueAfter, n.result.RequeueAfter)
+		if n.err != nil {
+			errs = append(errs, &ActionError{Action: a.Name, Err: n.err})
 		}
-		// Any component Action not fully reconciled means this
-		// Procedure isn't either
-		if result.Status != corev1.ConditionTrue {
+		if n.err != nil || n.result.Status != corev1.ConditionTrue {
 			status.FullyReconciled = false
 		}
+	}
 
-		ar := ActionResult{
-			Name:   step.Name,
-			Result: result,
-		}
-		status.Results = append(status.Results, ar)
+	// Gather the results in the order the actions were defined so that the
+	// status doesn't depend on the order of execution
+	for _, step := range p.actions {
+		status.Results = append(status.Results, run.result(step))
 	}
+	status.WaitingForBudget = run.budgetUse.waitingActions()
+	status.Drift = run.drift.sorted()
 
+	if len(errs) > 0 {
+		return &status, errs
+	}
 	return &status, nil
 }
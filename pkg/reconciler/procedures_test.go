@@ -1,10 +1,19 @@
 package reconciler
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -38,7 +47,7 @@ func TestProcedureClearsCached(t *testing.T) {
 	var scheme *runtime.Scheme
 
 	count = 0
-	ps, err := v7.Execute(request, client, scheme)
+	ps, err := v7.Execute(context.TODO(), request, client, scheme)
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
@@ -48,7 +57,7 @@ func TestProcedureClearsCached(t *testing.T) {
 	if count != 1 {
 		t.Errorf("countAction should have been called once; actual: %d", count)
 	}
-	_, _ = v7.Execute(request, client, scheme)
+	_, _ = v7.Execute(context.TODO(), request, client, scheme)
 	if count != 2 {
 		t.Errorf("countAction should have been called twice; actual: %d", count)
 	}
@@ -64,7 +73,7 @@ func TestProcedureReturnsActionError(t *testing.T) {
 	client := fake.NewFakeClient()
 	var scheme *runtime.Scheme
 
-	_, err := v9.Execute(request, client, scheme)
+	_, err := v9.Execute(context.TODO(), request, client, scheme)
 	if err == nil {
 		t.Errorf("Execute should have returned an error")
 	}
@@ -80,7 +89,7 @@ func TestProcedureNotFullyReconciledIfFalseAction(t *testing.T) {
 	client := fake.NewFakeClient()
 	var scheme *runtime.Scheme
 
-	ps, err := v8.Execute(request, client, scheme)
+	ps, err := v8.Execute(context.TODO(), request, client, scheme)
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
@@ -111,7 +120,7 @@ func TestPrereqsHaveCacheCleared(t *testing.T) {
 		actions:    []*Action{&a},
 	}
 	count = 0
-	_, err := p.Execute(request, client, scheme)
+	_, err := p.Execute(context.TODO(), request, client, scheme)
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
@@ -120,7 +129,7 @@ func TestPrereqsHaveCacheCleared(t *testing.T) {
 	}
 	// execute again. The cache should be cleared, causing count to
 	// increase.
-	_, err = p.Execute(request, client, scheme)
+	_, err = p.Execute(context.TODO(), request, client, scheme)
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
@@ -198,3 +207,282 @@ func TestNewestCompatible(t *testing.T) {
 	}
 
 }
+
+func TestProcedureStopsWhenCancelled(t *testing.T) {
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "name",
+			Namespace: "namespace",
+		},
+	}
+	client := fake.NewFakeClient()
+	var scheme *runtime.Scheme
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	count = 0
+	if _, err := v7.Execute(ctx, request, client, scheme); err == nil {
+		t.Errorf("Execute should have returned an error")
+	}
+	if count != 0 {
+		t.Errorf("countAction should not have been called; actual: %d", count)
+	}
+}
+
+// echoAction reports the name of the request it was executed for, so
+// results that leak between concurrent executions can be detected.
+var echoAction = Action{
+	Name: "echoAction",
+	action: func(_ context.Context, request reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+		return Result{Status: corev1.ConditionTrue, Message: request.Name}, nil
+	},
+}
+
+var echoDependentAction = Action{
+	Name:    "echoDependentAction",
+	prereqs: []*Action{&echoAction},
+	action: func(_ context.Context, request reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+		return Result{Status: corev1.ConditionTrue, Message: request.Name}, nil
+	},
+}
+
+// Run with -race to detect shared state between executions
+func TestProcedureConcurrentExecutions(t *testing.T) {
+	client := fake.NewFakeClient()
+	var scheme *runtime.Scheme
+	p := Procedure{
+		version:    1,
+		minVersion: 1,
+		actions:    []*Action{&echoAction, &echoDependentAction},
+	}
+
+	const executions = 20
+	var wg sync.WaitGroup
+	for i := 0; i < executions; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			request := reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      name,
+					Namespace: "namespace",
+				},
+			}
+			for j := 0; j < 10; j++ {
+				ps, err := p.Execute(context.TODO(), request, client, scheme)
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+				for _, r := range ps.Results {
+					if r.Message != name {
+						t.Errorf("%s: result from execution for %s leaked into execution for %s", r.Name, r.Message, name)
+					}
+				}
+			}
+		}(fmt.Sprintf("cluster-%d", i))
+	}
+	wg.Wait()
+}
+
+func TestProcedureRunsIndependentActionsConcurrently(t *testing.T) {
+	// Each action waits for the other to start, so they can only succeed
+	// if they are running at the same time.
+	var started sync.WaitGroup
+	started.Add(2)
+	rendezvous := func(ctx context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+		started.Done()
+		started.Wait()
+		return Result{Status: corev1.ConditionTrue, Message: "met"}, nil
+	}
+	p := MustNewProcedure(1, 1, []*Action{
+		NewAction("left", []*Action{}, rendezvous, WithTimeout(time.Second)),
+		NewAction("right", []*Action{}, rendezvous, WithTimeout(time.Second)),
+	}, WithWorkers(2))
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "name",
+			Namespace: "namespace",
+		},
+	}
+	client := fake.NewFakeClient()
+	var scheme *runtime.Scheme
+
+	ps, err := p.Execute(context.TODO(), request, client, scheme)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !ps.FullyReconciled {
+		t.Errorf("actions should have run concurrently: %v", ps.Results)
+	}
+}
+
+func TestProcedureLimitsWorkers(t *testing.T) {
+	var running, maxRunning int32
+	busy := func(ctx context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+		now := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if now <= max || atomic.CompareAndSwapInt32(&maxRunning, max, now) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return Result{Status: corev1.ConditionTrue, Message: "done"}, nil
+	}
+	var actions []*Action
+	for i := 0; i < 8; i++ {
+		actions = append(actions, NewAction(fmt.Sprintf("busy%d", i), []*Action{}, busy))
+	}
+	p := MustNewProcedure(1, 1, actions, WithWorkers(3))
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "name",
+			Namespace: "namespace",
+		},
+	}
+	client := fake.NewFakeClient()
+	var scheme *runtime.Scheme
+
+	if _, err := p.Execute(context.TODO(), request, client, scheme); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if maxRunning > 3 {
+		t.Errorf("at most 3 actions should have run at once; actual: %d", maxRunning)
+	}
+}
+
+func TestProcedureRunsPrereqsFirst(t *testing.T) {
+	var mutex sync.Mutex
+	var order []string
+	record := func(name string) ActionFunc {
+		return func(ctx context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			order = append(order, name)
+			return Result{Status: corev1.ConditionTrue, Message: name}, nil
+		}
+	}
+	first := NewAction("first", []*Action{}, record("first"))
+	second := NewAction("second", []*Action{first}, record("second"))
+	third := NewAction("third", []*Action{first, second}, record("third"))
+	p := MustNewProcedure(1, 1, []*Action{third, second, first}, WithWorkers(8))
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "name",
+			Namespace: "namespace",
+		},
+	}
+	client := fake.NewFakeClient()
+	var scheme *runtime.Scheme
+
+	for i := 0; i < 20; i++ {
+		order = nil
+		ps, err := p.Execute(context.TODO(), request, client, scheme)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := strings.Join(order, ","); got != "first,second,third" {
+			t.Errorf("actions executed out of order: %s", got)
+		}
+		// Results are in the order the actions were defined, regardless
+		// of the order they were executed.
+		var names []string
+		for _, r := range ps.Results {
+			names = append(names, r.Name)
+		}
+		if got := strings.Join(names, ","); got != "third,second,first" {
+			t.Errorf("results are not in definition order: %s", got)
+		}
+	}
+}
+
+func TestProcedureCombinesRequeueHints(t *testing.T) {
+	hint := func(status corev1.ConditionStatus, after time.Duration) ActionFunc {
+		return func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+			return Result{Status: status, Message: "hint", RequeueAfter: after}, nil
+		}
+	}
+	prereq := NewAction("prereq", []*Action{}, hint(corev1.ConditionTrue, 3*time.Second))
+	p := MustNewProcedure(1, 1, []*Action{
+		NewAction("none", []*Action{}, hint(corev1.ConditionTrue, 0)),
+		NewAction("slow", []*Action{prereq}, hint(corev1.ConditionFalse, 10*time.Second)),
+		NewAction("fast", []*Action{}, hint(corev1.ConditionFalse, 5*time.Second)),
+	})
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "name",
+			Namespace: "namespace",
+		},
+	}
+	client := fake.NewFakeClient()
+	var scheme *runtime.Scheme
+
+	ps, err := p.Execute(context.TODO(), request, client, scheme)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ps.RequeueAfter != 3*time.Second {
+		t.Errorf("expected earliest hint of %v; got %v", 3*time.Second, ps.RequeueAfter)
+	}
+}
+
+func TestProcedureContinuesAfterActionError(t *testing.T) {
+	errPrereq := errors.New("prereq error")
+	failingPrereq := NewAction("failingPrereq", []*Action{}, func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+		return Result{}, errPrereq
+	})
+	blocked := NewAction("blocked", []*Action{failingPrereq}, trueAction.action)
+	p := MustNewProcedure(1, 1, []*Action{&errorAction, &countAction, blocked, &falseAction})
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "name",
+			Namespace: "namespace",
+		},
+	}
+	client := fake.NewFakeClient()
+	var scheme *runtime.Scheme
+
+	count = 0
+	ps, err := p.Execute(context.TODO(), request, client, scheme)
+	if ps == nil {
+		t.Fatalf("status should be returned along with the error")
+	}
+	if count != 1 {
+		t.Errorf("independent action should have been executed once; actual: %d", count)
+	}
+	errs, ok := err.(Errors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected both errors; got: %v", err)
+	}
+	if errs[0].(*ActionError).Err != errGeneric || errs[1].(*ActionError).Err != errPrereq {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if ps.FullyReconciled {
+		t.Errorf("procedure should not have been fully reconciled")
+	}
+
+	expected := map[string]corev1.ConditionStatus{
+		"errorAction":    corev1.ConditionUnknown,
+		"CountingAction": corev1.ConditionTrue,
+		"blocked":        corev1.ConditionUnknown,
+		"falseAction":    corev1.ConditionFalse,
+	}
+	if len(ps.Results) != len(expected) {
+		t.Errorf("expected a result for each action; got: %v", ps.Results)
+	}
+	for _, r := range ps.Results {
+		if r.Status != expected[r.Name] {
+			t.Errorf("%s -- expected: %v -- got: %v", r.Name, expected[r.Name], r.Status)
+		}
+	}
+	if ps.Results[0].Message != "error: an error" {
+		t.Errorf("error should be reported in the result; got: %q", ps.Results[0].Message)
+	}
+}
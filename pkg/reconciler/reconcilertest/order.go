@@ -0,0 +1,194 @@
+package reconcilertest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gluster/anthill/pkg/reconciler"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// MaxOrderings is the largest number of orderings that CheckAllOrders will
+// try. Larger graphs should be checked with CheckSeeds.
+const MaxOrderings = 1000
+
+// Outcome is what an action returned during a Run
+type Outcome struct {
+	Result reconciler.Result
+	Err    error
+}
+
+// Run is the outcome of executing a Procedure in one particular order
+type Run struct {
+	// Order lists the actions, including prereqs, in the order they
+	// completed. Since actions are run one at a time, this is also the
+	// order in which they were started.
+	Order []string
+	// Outcomes holds what each action returned, by name
+	Outcomes map[string]Outcome
+	// Status and Err are as returned by Procedure.Execute
+	Status *reconciler.ProcedureStatus
+	Err    error
+}
+
+func (r Run) String() string {
+	return strings.Join(r.Order, ", ")
+}
+
+// recorder is a reconciler.Scheduler that records the Run. choose picks the
+// next action out of the given number of ready ones.
+type recorder struct {
+	run    *Run
+	choose func(options int) int
+}
+
+func (rec *recorder) Next(ready []*reconciler.Action) int {
+	return rec.choose(len(ready))
+}
+
+func (rec *recorder) Completed(a *reconciler.Action, result reconciler.Result, err error) {
+	rec.run.Order = append(rec.run.Order, a.Name)
+	rec.run.Outcomes[a.Name] = Outcome{Result: result, Err: err}
+}
+
+// execute runs the Procedure, using choose to pick the order
+func execute(p *reconciler.Procedure, choose func(options int) int, request reconcile.Request,
+	client client.Client, scheme *runtime.Scheme) Run {
+	run := Run{Outcomes: make(map[string]Outcome)}
+	ctx := reconciler.WithScheduler(context.Background(), &recorder{run: &run, choose: choose})
+	run.Status, run.Err = p.Execute(ctx, request, client, scheme)
+	return run
+}
+
+// ExecuteSeeded executes the Procedure, starting the ready actions one at a
+// time in a pseudo-random order that is fully determined by seed.
+func ExecuteSeeded(p *reconciler.Procedure, seed int64, request reconcile.Request,
+	client client.Client, scheme *runtime.Scheme) Run {
+	r := rand.New(rand.NewSource(seed))
+	return execute(p, r.Intn, request, client, scheme)
+}
+
+// ExecuteAllOrders executes the Procedure once for each order in which its
+// actions can be started without violating their prereqs. Each execution
+// uses a new client from newClient, so that they all start from the same
+// state. An error is returned if there are more than max orderings.
+func ExecuteAllOrders(p *reconciler.Procedure, max int, request reconcile.Request,
+	newClient func() client.Client, scheme *runtime.Scheme) ([]Run, error) {
+	var runs []Run
+	// Each ordering is identified by the choice made at each step, with
+	// the orderings enumerated like the digits of an odometer. The number
+	// of ready actions at each step depends only on the graph, not the
+	// results, so replaying a prefix of choices reaches the same state.
+	var choices []int
+	for {
+		var taken, options []int
+		choose := func(n int) int {
+			c := 0
+			if len(taken) < len(choices) {
+				c = choices[len(taken)]
+			}
+			taken = append(taken, c)
+			options = append(options, n)
+			return c
+		}
+		if len(runs) == max {
+			return runs, fmt.Errorf("procedure version %d has more than %d orderings", p.Version(), max)
+		}
+		runs = append(runs, execute(p, choose, request, newClient(), scheme))
+
+		i := len(taken) - 1
+		for i >= 0 && taken[i]+1 >= options[i] {
+			i--
+		}
+		if i < 0 {
+			return runs, nil
+		}
+		choices = append(taken[:i:i], taken[i]+1)
+	}
+}
+
+// Compare returns a description of each difference between the outcomes of
+// the actions in the runs. Results are compared on status and message, and
+// errors on their text. Each action is compared to its outcome in the first
+// run that executed it.
+func Compare(runs []Run) []string {
+	var diffs []string
+	first := make(map[string]int)
+	for i, run := range runs {
+		names := make([]string, 0, len(run.Outcomes))
+		for name := range run.Outcomes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			j, ok := first[name]
+			if !ok {
+				first[name] = i
+				continue
+			}
+			want, got := runs[j].Outcomes[name], run.Outcomes[name]
+			if !sameOutcome(want, got) {
+				diffs = append(diffs, fmt.Sprintf("action %s depends on the order of execution:\n"+
+					"  order [%v]: %s\n  order [%v]: %s", name, runs[j], describe(want), run, describe(got)))
+			}
+		}
+	}
+	return diffs
+}
+
+func sameOutcome(a, b Outcome) bool {
+	return a.Result.Status == b.Result.Status &&
+		a.Result.Message == b.Result.Message &&
+		describeErr(a.Err) == describeErr(b.Err)
+}
+
+func describe(o Outcome) string {
+	s := fmt.Sprintf("%s %q", o.Result.Status, o.Result.Message)
+	if o.Err != nil {
+		s += fmt.Sprintf(" (error: %v)", o.Err)
+	}
+	return s
+}
+
+func describeErr(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// CheckAllOrders reports a test error for each action of the Procedure
+// whose outcome depends on the order in which the actions are executed,
+// trying every valid order. See ExecuteAllOrders.
+func CheckAllOrders(t *testing.T, p *reconciler.Procedure, request reconcile.Request,
+	newClient func() client.Client, scheme *runtime.Scheme) {
+	t.Helper()
+	runs, err := ExecuteAllOrders(p, MaxOrderings, request, newClient, scheme)
+	if err != nil {
+		t.Fatalf("%v; use CheckSeeds instead", err)
+	}
+	for _, diff := range Compare(runs) {
+		t.Error(diff)
+	}
+}
+
+// CheckSeeds is like CheckAllOrders, but only tries the orders determined by
+// the seeds (see ExecuteSeeded). It is intended for graphs that are too
+// large to try every order.
+func CheckSeeds(t *testing.T, p *reconciler.Procedure, seeds []int64, request reconcile.Request,
+	newClient func() client.Client, scheme *runtime.Scheme) {
+	t.Helper()
+	var runs []Run
+	for _, seed := range seeds {
+		runs = append(runs, ExecuteSeeded(p, seed, request, newClient(), scheme))
+	}
+	for _, diff := range Compare(runs) {
+		t.Error(diff)
+	}
+}
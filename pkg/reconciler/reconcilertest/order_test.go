@@ -0,0 +1,130 @@
+package reconcilertest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gluster/anthill/pkg/reconciler"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func trueFunc(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (reconciler.Result, error) {
+	return reconciler.Result{Status: corev1.ConditionTrue, Message: "it's true"}, nil
+}
+
+func newClient() client.Client {
+	return fake.NewFakeClient()
+}
+
+func TestExecuteAllOrders(t *testing.T) {
+	// diamond: d -> (b, c) -> a
+	a := reconciler.NewAction("a", []*reconciler.Action{}, trueFunc)
+	b := reconciler.NewAction("b", []*reconciler.Action{a}, trueFunc)
+	c := reconciler.NewAction("c", []*reconciler.Action{a}, trueFunc)
+	d := reconciler.NewAction("d", []*reconciler.Action{b, c}, trueFunc)
+	x := reconciler.NewAction("x", []*reconciler.Action{}, trueFunc)
+	y := reconciler.NewAction("y", []*reconciler.Action{}, trueFunc)
+	z := reconciler.NewAction("z", []*reconciler.Action{}, trueFunc)
+
+	var tests = []struct {
+		actions  []*reconciler.Action
+		expected []string
+	}{
+		{[]*reconciler.Action{d}, []string{"a, b, c, d", "a, c, b, d"}},
+		{[]*reconciler.Action{x, y, z}, []string{
+			"x, y, z", "x, z, y", "y, x, z", "y, z, x", "z, x, y", "z, y, x",
+		}},
+	}
+	for _, test := range tests {
+		p := reconciler.MustNewProcedure(0, 1, test.actions)
+		runs, err := ExecuteAllOrders(p, MaxOrderings, reconcile.Request{}, newClient, nil)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			continue
+		}
+		var orders []string
+		for _, run := range runs {
+			orders = append(orders, run.String())
+			if run.Err != nil || !run.Status.FullyReconciled {
+				t.Errorf("order [%v] failed: %v", run, run.Err)
+			}
+		}
+		if strings.Join(orders, "; ") != strings.Join(test.expected, "; ") {
+			t.Errorf("expected orders %q; got %q", test.expected, orders)
+		}
+	}
+}
+
+func TestExecuteAllOrdersLimit(t *testing.T) {
+	var actions []*reconciler.Action
+	for i := 0; i < 4; i++ {
+		actions = append(actions, reconciler.NewAction(fmt.Sprintf("a%d", i), []*reconciler.Action{}, trueFunc))
+	}
+	p := reconciler.MustNewProcedure(0, 1, actions)
+	// 4 independent actions have 24 orderings
+	if _, err := ExecuteAllOrders(p, 23, reconcile.Request{}, newClient, nil); err == nil {
+		t.Errorf("expected the limit to be exceeded")
+	}
+	if runs, err := ExecuteAllOrders(p, 24, reconcile.Request{}, newClient, nil); err != nil || len(runs) != 24 {
+		t.Errorf("expected 24 orderings; got %d, %v", len(runs), err)
+	}
+}
+
+func TestExecuteSeededIsReproducible(t *testing.T) {
+	var actions []*reconciler.Action
+	for i := 0; i < 6; i++ {
+		actions = append(actions, reconciler.NewAction(fmt.Sprintf("a%d", i), []*reconciler.Action{}, trueFunc))
+	}
+	p := reconciler.MustNewProcedure(0, 1, actions)
+	for seed := int64(0); seed < 5; seed++ {
+		first := ExecuteSeeded(p, seed, reconcile.Request{}, newClient(), nil)
+		second := ExecuteSeeded(p, seed, reconcile.Request{}, newClient(), nil)
+		if first.String() != second.String() {
+			t.Errorf("seed %d gave orders [%v] and [%v]", seed, first, second)
+		}
+	}
+}
+
+func TestCompareFlagsOrderDependentActions(t *testing.T) {
+	// Both actions rely on state that neither declares as a prereq
+	var started int
+	racer := func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (reconciler.Result, error) {
+		started++
+		if started == 1 {
+			return reconciler.Result{Status: corev1.ConditionTrue, Message: "first"}, nil
+		}
+		return reconciler.Result{Status: corev1.ConditionFalse, Message: "not first"}, nil
+	}
+	first := reconciler.NewAction("first", []*reconciler.Action{}, racer)
+	second := reconciler.NewAction("second", []*reconciler.Action{}, racer)
+	stable := reconciler.NewAction("stable", []*reconciler.Action{}, trueFunc)
+	p := reconciler.MustNewProcedure(0, 1, []*reconciler.Action{first, second, stable})
+
+	resetClient := func() client.Client {
+		started = 0
+		return newClient()
+	}
+	runs, err := ExecuteAllOrders(p, MaxOrderings, reconcile.Request{}, resetClient, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	diffs := Compare(runs)
+	if len(diffs) == 0 {
+		t.Fatalf("order dependent actions were not flagged")
+	}
+	for _, diff := range diffs {
+		if strings.Contains(diff, "action stable") {
+			t.Errorf("stable was flagged: %s", diff)
+		}
+	}
+	if !strings.Contains(strings.Join(diffs, "\n"), "action first") ||
+		!strings.Contains(strings.Join(diffs, "\n"), "action second") {
+		t.Errorf("expected first and second to be flagged; got:\n%s", strings.Join(diffs, "\n"))
+	}
+}
@@ -0,0 +1,56 @@
+// Package reconcilertest provides helpers for testing code that uses the
+// reconciler package.
+package reconcilertest
+
+import (
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	"github.com/gluster/anthill/pkg/reconciler"
+)
+
+var updateDiagrams = flag.Bool("update-diagrams", false,
+	"regenerate the procedure diagrams checked by CheckDiagrams")
+
+// CheckProcedures reports a test error if any Procedure in the list has an
+// invalid action graph, or if the list itself is inconsistent. Controller
+// packages should call this on their list of all Procedures.
+func CheckProcedures(t *testing.T, procedures reconciler.ProcedureList) {
+	t.Helper()
+	if len(procedures) == 0 {
+		t.Error("the list of procedures is empty")
+	}
+	if err := procedures.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+// CheckDiagrams reports a test error if the DOT and Mermaid diagrams of the
+// Procedure, checked in at path + ".dot" and path + ".mmd", do not match
+// the Procedure's actual action graph. Running the test with
+// -update-diagrams rewrites the files instead.
+func CheckDiagrams(t *testing.T, p *reconciler.Procedure, name string, path string) {
+	t.Helper()
+	diagrams := map[string]string{
+		path + ".dot": p.DOT(name),
+		path + ".mmd": p.Mermaid(name),
+	}
+	for file, want := range diagrams {
+		if *updateDiagrams {
+			if err := ioutil.WriteFile(file, []byte(want), 0644); err != nil {
+				t.Errorf("unable to update %s: %v", file, err)
+			}
+			continue
+		}
+		got, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Errorf("unable to read %s: %v", file, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s does not match the %s procedure; rerun the test with -update-diagrams\n"+
+				"expected:\n%s\nactual:\n%s", file, name, want, got)
+		}
+	}
+}
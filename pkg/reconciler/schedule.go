@@ -0,0 +1,53 @@
+package reconciler
+
+import (
+	"context"
+	"sort"
+)
+
+// Scheduler decides the order in which an execution starts the Actions that
+// are ready to run, and is told the outcome of each. It is intended for
+// tests that need a reproducible order (see package reconcilertest); by
+// default, the order is random.
+type Scheduler interface {
+	// Next returns the index of the Action to start next. ready is sorted
+	// by name and is never empty.
+	Next(ready []*Action) int
+	// Completed is called once an Action has completed, including Actions
+	// that were not run because their prereqs were not met
+	Completed(a *Action, result Result, err error)
+}
+
+type schedulerKey struct{}
+
+// WithScheduler returns a context that causes Procedures and Actions that
+// are executed with it to be scheduled by s. Actions are then executed one
+// at a time, regardless of the Procedure's worker limit, so that the order
+// is fully determined by s.
+func WithScheduler(ctx context.Context, s Scheduler) context.Context {
+	return context.WithValue(ctx, schedulerKey{}, s)
+}
+
+// schedulerFrom returns the Scheduler of the context, or nil if there is none
+func schedulerFrom(ctx context.Context) Scheduler {
+	s, _ := ctx.Value(schedulerKey{}).(Scheduler)
+	return s
+}
+
+// next removes and returns the next node to start from ready, chosen by the
+// Scheduler, if any, or else the first one
+func next(s Scheduler, ready []*node) (*node, []*node) {
+	i := 0
+	if s != nil {
+		sort.Slice(ready, func(i, j int) bool {
+			return ready[i].action.Name < ready[j].action.Name
+		})
+		actions := make([]*Action, 0, len(ready))
+		for _, n := range ready {
+			actions = append(actions, n.action)
+		}
+		i = s.Next(actions)
+	}
+	n := ready[i]
+	return n, append(ready[:i], ready[i+1:]...)
+}
@@ -0,0 +1,330 @@
+//go:build serversideapply
+// +build serversideapply
+
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// Server-side apply needs the Patch method of controller-runtime v0.2 or
+// later, and API servers that support it (Kubernetes 1.16 or later), so it
+// is only built w/ the serversideapply tag.
+func init() {
+	serverSideApply = ensurer.applyServerSide
+}
+
+// applyServerSide creates or updates the object w/ server-side apply, as
+// FieldManager. The fields set by other managers are left alone. If some of
+// the fields the operator sets are managed by others, the object has
+// drifted: those fields are left alone unless the policy is DriftCorrect, in
+// which case the operator takes them back.
+func (e ensurer) applyServerSide(ctx context.Context, obj, existing runtime.Object, policy DriftPolicy, c client.Client, scheme *runtime.Scheme) (Result, error) {
+	data, err := applyConfiguration(obj, scheme)
+	if err != nil {
+		return Result{}, err
+	}
+	patch := client.RawPatch(types.ApplyPatchType, data)
+	err = c.Patch(ctx, obj, patch, client.FieldOwner(FieldManager))
+	drift := conflictDrift(obj, err)
+	if drift != nil {
+		drift.Action = e.name
+		if policy != DriftCorrect {
+			// The other fields are still applied; the drifted ones are
+			// left to their managers
+			recordDrift(ctx, *drift)
+			others, err := withoutFields(data, drift.Fields)
+			if err != nil {
+				return Result{}, err
+			}
+			if err := c.Patch(ctx, obj, client.RawPatch(types.ApplyPatchType, others), client.FieldOwner(FieldManager)); err != nil {
+				return Result{}, err
+			}
+			return Result{Status: corev1.ConditionFalse, Message: drift.String()}, nil
+		}
+		drift.Corrected = true
+		if err = c.Patch(ctx, obj, patch, client.FieldOwner(FieldManager), client.ForceOwnership); err == nil {
+			recordDrift(ctx, *drift)
+		}
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	var message string
+	switch {
+	case existing == nil:
+		message = fmt.Sprintf("created %s", describeObject(obj))
+	case drift != nil:
+		message = drift.String()
+	case !changed(obj, existing):
+		return rollout(obj), nil
+	default:
+		message = fmt.Sprintf("updated %s", describeObject(obj))
+	}
+	return Result{
+		Status:       corev1.ConditionUnknown,
+		Message:      message,
+		RequeueAfter: RolloutRequeueAfter,
+	}, nil
+}
+
+// applyConfiguration returns the configuration that is applied for the
+// desired object: its kind and the fields it sets, including
+// LastAppliedAnnotation, so that checks can still tell which fields the
+// operator sets
+func applyConfiguration(obj runtime.Object, scheme *runtime.Scheme) ([]byte, error) {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return nil, err
+	}
+	if err := setLastApplied(obj); err != nil {
+		return nil, err
+	}
+	data, err := configOf(obj)
+	if err != nil {
+		return nil, err
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	config["apiVersion"], config["kind"] = gvk.GroupVersion().String(), gvk.Kind
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	metadata, ok := config["metadata"].(map[string]interface{})
+	if !ok {
+		metadata = make(map[string]interface{})
+		config["metadata"] = metadata
+	}
+	annotations, ok := metadata["annotations"].(map[string]interface{})
+	if !ok {
+		annotations = make(map[string]interface{})
+		metadata["annotations"] = annotations
+	}
+	annotations[LastAppliedAnnotation] = accessor.GetAnnotations()[LastAppliedAnnotation]
+	return json.Marshal(config)
+}
+
+// conflictDrift returns the drift of the object if err is the conflict
+// reported by the API server when the fields applied are managed by others,
+// or nil
+func conflictDrift(obj runtime.Object, err error) *Drift {
+	status, ok := err.(errors.APIStatus)
+	if !ok || !errors.IsConflict(err) || status.Status().Details == nil {
+		return nil
+	}
+	var fields []string
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type == metav1.CauseTypeFieldManagerConflict {
+			fields = append(fields, strings.TrimPrefix(cause.Field, "."))
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	sort.Strings(fields)
+	return &Drift{Object: describeObject(obj), Fields: fields}
+}
+
+// withoutFields returns the configuration w/o the fields, given as the paths
+// reported in conflicts (e.g., `spec.template.spec.containers[name="a"].image`)
+func withoutFields(data []byte, fields []string) ([]byte, error) {
+	var config map[string]interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		path, err := parseFieldPath(field)
+		if err != nil {
+			return nil, err
+		}
+		pruneField(config, path)
+	}
+	return json.Marshal(config)
+}
+
+// pathElement is an element of a field path: the name of a field, or the
+// key, index or value of an item of a list
+type pathElement struct {
+	field string
+	key   map[string]interface{}
+	index *int
+	value interface{}
+}
+
+// parseFieldPath parses a field path reported in conflicts
+func parseFieldPath(field string) ([]pathElement, error) {
+	var path []pathElement
+	for rest := "." + field; rest != ""; {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			path = append(path, pathElement{field: rest[1:end]})
+			rest = rest[end:]
+		case '[':
+			end := closingBracket(rest)
+			if end < 0 {
+				return nil, fmt.Errorf("invalid field path %s", field)
+			}
+			element, err := parseListElement(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid field path %s: %v", field, err)
+			}
+			path = append(path, element)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid field path %s", field)
+		}
+	}
+	return path, nil
+}
+
+// closingBracket returns the index of the bracket that closes the one at the
+// start of s, skipping quoted strings, or -1
+func closingBracket(s string) int {
+	quoted := false
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseListElement parses the selector of a list item: an index (`0`), a
+// value (`="a"`) or the values of its keys (`name="a",port=80`)
+func parseListElement(selector string) (pathElement, error) {
+	var element pathElement
+	if index, err := strconv.Atoi(selector); err == nil {
+		element.index = &index
+		return element, nil
+	}
+	if strings.HasPrefix(selector, "=") {
+		err := json.Unmarshal([]byte(selector[1:]), &element.value)
+		return element, err
+	}
+	element.key = make(map[string]interface{})
+	for _, pair := range splitUnquoted(selector, ',') {
+		i := strings.Index(pair, "=")
+		if i < 0 {
+			return element, fmt.Errorf("invalid key %s", pair)
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(pair[i+1:]), &value); err != nil {
+			return element, err
+		}
+		element.key[pair[:i]] = value
+	}
+	return element, nil
+}
+
+// splitUnquoted splits s around the separators that aren't quoted
+func splitUnquoted(s string, separator byte) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == separator:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// matches returns whether the item at index i of a list is selected by the
+// element
+func (pe pathElement) matches(i int, item interface{}) bool {
+	switch {
+	case pe.field != "":
+		return false
+	case pe.index != nil:
+		return *pe.index == i
+	case pe.key != nil:
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for name, value := range pe.key {
+			if !reflect.DeepEqual(fields[name], value) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(item, pe.value)
+}
+
+// pruneField returns the value w/o the field at the path, if it is set
+func pruneField(value interface{}, path []pathElement) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		child, ok := v[path[0].field]
+		switch {
+		case !ok:
+		case len(path) == 1:
+			delete(v, path[0].field)
+		default:
+			v[path[0].field] = pruneField(child, path[1:])
+		}
+	case []interface{}:
+		for i, item := range v {
+			if !path[0].matches(i, item) {
+				continue
+			}
+			if len(path) == 1 {
+				return append(v[:i:i], v[i+1:]...)
+			}
+			v[i] = pruneField(item, path[1:])
+			break
+		}
+	}
+	return value
+}
+
+// changed returns whether applying the object changed the existing one,
+// other than who manages its fields
+func changed(applied, existing runtime.Object) bool {
+	objs := []runtime.Object{applied.DeepCopyObject(), existing.DeepCopyObject()}
+	for _, obj := range objs {
+		obj.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{})
+		if accessor, err := meta.Accessor(obj); err == nil {
+			accessor.SetManagedFields(nil)
+			accessor.SetResourceVersion("")
+		}
+	}
+	return !equality.Semantic.DeepEqual(objs[0], objs[1])
+}
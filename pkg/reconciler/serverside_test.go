@@ -0,0 +1,169 @@
+//go:build serversideapply
+// +build serversideapply
+
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestServerSideApply(t *testing.T) {
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "owner", Namespace: "namespace"}}
+	key := types.NamespacedName{Name: "ensured", Namespace: "namespace"}
+	owner := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "namespace", UID: "owner-uid"},
+		Data:       map[string]string{"image": "ensured:latest"},
+	}
+	c := fake.NewClientBuilder().WithObjects(owner).WithReturnManagedFields().Build()
+	p := MustNewProcedure(0, 0, []*Action{EnsureObject("ensured", []*Action{}, desiredStatefulSet)})
+	get := func() *appsv1.StatefulSet {
+		ss := &appsv1.StatefulSet{}
+		if err := c.Get(context.TODO(), key, ss); err != nil {
+			t.Fatalf("unable to get the StatefulSet: %v", err)
+		}
+		return ss
+	}
+	// edit changes the StatefulSet as an admin would
+	edit := func(change func(ss *appsv1.StatefulSet)) func() {
+		return func() {
+			ss := get()
+			change(ss)
+			if err := c.Update(context.TODO(), ss, client.FieldOwner("kubectl-edit")); err != nil {
+				t.Fatalf("unable to update the StatefulSet: %v", err)
+			}
+		}
+	}
+	setImage := func(image string) func() {
+		return func() {
+			owner.Data["image"] = image
+			if err := c.Update(context.TODO(), owner); err != nil {
+				t.Fatalf("unable to update the owner: %v", err)
+			}
+		}
+	}
+	drifted := "StatefulSet namespace/ensured has drifted (spec.template.spec.containers[name=\"ensured\"].image)"
+	corrected := "StatefulSet namespace/ensured had drifted and was corrected (spec.template.spec.containers[name=\"ensured\"].image)"
+
+	var steps = []struct {
+		name        string
+		change      func()
+		policy      DriftPolicy
+		wantCond    corev1.ConditionStatus
+		wantMessage string
+		wantImages  []string
+		wantDrift   bool
+	}{
+		{"created", nil, "",
+			corev1.ConditionUnknown, "created StatefulSet namespace/ensured",
+			[]string{"ensured:latest"}, false},
+		{"nothing to apply", nil, "",
+			corev1.ConditionUnknown, "waiting for rollout of StatefulSet namespace/ensured: 0 of 1 replicas ready",
+			[]string{"ensured:latest"}, false},
+		{"sidecar added", edit(func(ss *appsv1.StatefulSet) {
+			ss.Spec.Template.Spec.Containers = append(ss.Spec.Template.Spec.Containers,
+				corev1.Container{Name: "debug", Image: "debug:latest"})
+		}), "",
+			corev1.ConditionUnknown, "waiting for rollout of StatefulSet namespace/ensured: 0 of 1 replicas ready",
+			[]string{"ensured:latest", "debug:latest"}, false},
+		{"desired changed", setImage("new:latest"), "",
+			corev1.ConditionUnknown, "updated StatefulSet namespace/ensured",
+			[]string{"new:latest", "debug:latest"}, false},
+		{"conflict", edit(func(ss *appsv1.StatefulSet) {
+			ss.Spec.Template.Spec.Containers[0].Image = "other:latest"
+		}), "",
+			corev1.ConditionFalse, drifted,
+			[]string{"other:latest", "debug:latest"}, true},
+		{"conflict corrected", nil, DriftCorrect,
+			corev1.ConditionUnknown, corrected,
+			[]string{"new:latest", "debug:latest"}, true},
+	}
+	for _, step := range steps {
+		if step.change != nil {
+			step.change()
+		}
+		ctx := WithDriftPolicy(context.TODO(), step.policy)
+		status, err := p.Execute(ctx, request, c, scheme.Scheme)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		if got := status.Results[0]; got.Status != step.wantCond || got.Message != step.wantMessage {
+			t.Errorf("%s: expected %v %q; got %+v", step.name, step.wantCond, step.wantMessage, got.Result)
+		}
+		if got := len(status.Drift) > 0; got != step.wantDrift {
+			t.Errorf("%s: unexpected drift: %+v", step.name, status.Drift)
+		}
+		ss := get()
+		var images []string
+		for _, container := range ss.Spec.Template.Spec.Containers {
+			images = append(images, container.Image)
+		}
+		if !reflect.DeepEqual(images, step.wantImages) {
+			t.Errorf("%s: expected images %v; got %v", step.name, step.wantImages, images)
+		}
+		managed := false
+		for _, entry := range ss.ManagedFields {
+			managed = managed || (entry.Manager == FieldManager && entry.Operation == metav1.ManagedFieldsOperationApply)
+		}
+		if !managed {
+			t.Errorf("%s: expected the StatefulSet to be applied by %s; got %+v", step.name, FieldManager, ss.ManagedFields)
+		}
+	}
+}
+
+func TestWithoutFields(t *testing.T) {
+	config := `{"spec":{"replicas":1,"template":{"spec":{"containers":[` +
+		`{"name":"a","image":"a:latest","ports":[{"containerPort":80,"protocol":"TCP"},{"containerPort":81,"protocol":"TCP"}]},` +
+		`{"name":"b.c","image":"b:latest","args":["x","y"]}]}}}}`
+	var tests = []struct {
+		fields []string
+		want   string
+	}{
+		{[]string{"spec.replicas"},
+			`{"spec":{"template":{"spec":{"containers":[` +
+				`{"image":"a:latest","name":"a","ports":[{"containerPort":80,"protocol":"TCP"},{"containerPort":81,"protocol":"TCP"}]},` +
+				`{"args":["x","y"],"image":"b:latest","name":"b.c"}]}}}}`},
+		{[]string{`spec.template.spec.containers[name="a"].image`, `spec.template.spec.containers[name="b.c"].args[="y"]`},
+			`{"spec":{"replicas":1,"template":{"spec":{"containers":[` +
+				`{"name":"a","ports":[{"containerPort":80,"protocol":"TCP"},{"containerPort":81,"protocol":"TCP"}]},` +
+				`{"args":["x"],"image":"b:latest","name":"b.c"}]}}}}`},
+		{[]string{`spec.template.spec.containers[name="a"].ports[containerPort=81,protocol="TCP"]`, `spec.template.spec.containers[1]`},
+			`{"spec":{"replicas":1,"template":{"spec":{"containers":[` +
+				`{"image":"a:latest","name":"a","ports":[{"containerPort":80,"protocol":"TCP"}]}]}}}}`},
+		{[]string{"spec.missing", `spec.template.spec.containers[name="missing"].image`},
+			`{"spec":{"replicas":1,"template":{"spec":{"containers":[` +
+				`{"image":"a:latest","name":"a","ports":[{"containerPort":80,"protocol":"TCP"},{"containerPort":81,"protocol":"TCP"}]},` +
+				`{"args":["x","y"],"image":"b:latest","name":"b.c"}]}}}}`},
+	}
+	for _, tt := range tests {
+		got, err := withoutFields([]byte(config), tt.fields)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tt.fields, err)
+			continue
+		}
+		var gotConfig, wantConfig interface{}
+		if err := json.Unmarshal(got, &gotConfig); err != nil {
+			t.Fatalf("%v: unexpected error: %v", tt.fields, err)
+		}
+		if err := json.Unmarshal([]byte(tt.want), &wantConfig); err != nil {
+			t.Fatalf("%v: invalid test: %v", tt.fields, err)
+		}
+		if !reflect.DeepEqual(gotConfig, wantConfig) {
+			t.Errorf("%v: expected %s; got %s", tt.fields, tt.want, got)
+		}
+	}
+	if _, err := withoutFields([]byte(config), []string{"spec.template[name"}); err == nil {
+		t.Errorf("expected an invalid field path to be an error")
+	}
+}
@@ -0,0 +1,36 @@
+package reconciler
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Teardown runs the cleanups of the Procedure's actions, including prereqs,
+// in reverse order: an action is only cleaned up once all of the actions
+// that depend on it have been. Actions without a cleanup have nothing to
+// remove. The returned ProcedureStatus has a Result for each procedure-level
+// action, and is FullyReconciled once every cleanup has returned
+// corev1.ConditionTrue, at which point the teardown is complete. Errors and
+// cancellation are handled as by Execute.
+func (p *Procedure) Teardown(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (*ProcedureStatus, error) {
+	start := time.Now()
+	run := p.newExecution(ctx, cleanupPhase, request, client, scheme)
+	run.execute(p.actions, p.Workers())
+
+	if err := ctx.Err(); err != nil {
+		run.endTrace(start, nil, err)
+		return nil, err
+	}
+
+	status, err := p.status(run)
+	run.endTrace(start, status, err)
+	if status.FullyReconciled {
+		// Nothing is left to reconcile
+		unreconciled.set(run.kind, request.NamespacedName, true)
+	}
+	return status, err
+}
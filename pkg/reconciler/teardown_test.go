@@ -0,0 +1,112 @@
+package reconciler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// cleanupLog records the order in which cleanups run
+type cleanupLog struct {
+	mutex sync.Mutex
+	names []string
+}
+
+func (l *cleanupLog) cleanup(name string, status corev1.ConditionStatus) ActionOption {
+	return WithCleanup(func(_ context.Context, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) (Result, error) {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		l.names = append(l.names, name)
+		return Result{Status: status, Message: name + " removed"}, nil
+	})
+}
+
+func (l *cleanupLog) index(name string) int {
+	for i, n := range l.names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestTeardownRunsInReverseOrder(t *testing.T) {
+	var log cleanupLog
+	// csi -> nodes -> etcd -> crd, plus an independent action
+	crd := NewAction("crd", []*Action{}, trueAction.action, log.cleanup("crd", corev1.ConditionTrue))
+	etcd := NewAction("etcd", []*Action{crd}, trueAction.action, log.cleanup("etcd", corev1.ConditionTrue))
+	nodes := NewAction("nodes", []*Action{etcd}, trueAction.action, log.cleanup("nodes", corev1.ConditionTrue))
+	csi := NewAction("csi", []*Action{nodes, etcd}, trueAction.action, log.cleanup("csi", corev1.ConditionTrue))
+	other := NewAction("other", []*Action{}, trueAction.action)
+	p := MustNewProcedure(0, 1, []*Action{etcd, nodes, csi, other})
+
+	client := fake.NewFakeClient()
+	status, err := p.Teardown(context.TODO(), reconcile.Request{}, client, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !status.FullyReconciled {
+		t.Errorf("teardown should be complete: %v", status.Results)
+	}
+	order := []string{"csi", "nodes", "etcd", "crd"}
+	if len(log.names) != len(order) {
+		t.Fatalf("expected cleanups %v; got %v", order, log.names)
+	}
+	for i := range order {
+		if log.names[i] != order[i] {
+			t.Errorf("expected cleanups %v; got %v", order, log.names)
+			break
+		}
+	}
+	for _, r := range status.Results {
+		if r.Name == "other" && r.Message != "nothing to clean up" {
+			t.Errorf("unexpected result for other: %v", r.Result)
+		}
+	}
+}
+
+func TestTeardownWaitsForDependents(t *testing.T) {
+	var log cleanupLog
+	crd := NewAction("crd", []*Action{}, trueAction.action, log.cleanup("crd", corev1.ConditionTrue))
+	// The etcd cluster is still shutting down
+	etcd := NewAction("etcd", []*Action{crd}, trueAction.action, log.cleanup("etcd", corev1.ConditionFalse))
+	nodes := NewAction("nodes", []*Action{etcd}, trueAction.action, log.cleanup("nodes", corev1.ConditionTrue))
+	p := MustNewProcedure(0, 1, []*Action{nodes})
+
+	client := fake.NewFakeClient()
+	status, err := p.Teardown(context.TODO(), reconcile.Request{}, client, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status.FullyReconciled {
+		t.Errorf("teardown should not be complete while etcd remains")
+	}
+	if log.index("crd") != -1 {
+		t.Errorf("crd should not be cleaned up before etcd is gone; ran %v", log.names)
+	}
+	if log.index("nodes") > log.index("etcd") {
+		t.Errorf("nodes should be cleaned up before etcd; ran %v", log.names)
+	}
+}
+
+func TestTeardownReportsErrors(t *testing.T) {
+	failing := NewAction("failing", []*Action{}, trueAction.action, WithCleanup(errorAction.action))
+	dependent := NewAction("dependent", []*Action{failing}, trueAction.action)
+	p := MustNewProcedure(0, 1, []*Action{dependent})
+
+	client := fake.NewFakeClient()
+	status, err := p.Teardown(context.TODO(), reconcile.Request{}, client, nil)
+	if err == nil || !strings.Contains(err.Error(), "action failing failed") {
+		t.Errorf("expected the cleanup's error; got: %v", err)
+	}
+	if status == nil || status.FullyReconciled {
+		t.Errorf("teardown should not be complete: %v", status)
+	}
+}
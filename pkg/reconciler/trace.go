@@ -0,0 +1,180 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Span records the execution of a Procedure or of one of its Actions. All
+// the spans of an execution share a TraceID. The span of each Action has
+// the span of the Procedure as its parent, and links to the spans of the
+// Action's prereqs, so that the prereq that blocked or delayed an Action can
+// be found.
+type Span struct {
+	TraceID  string `json:"traceID"`
+	SpanID   string `json:"spanID"`
+	ParentID string `json:"parentID,omitempty"`
+	// Links are the SpanIDs of the spans that had to end before this one
+	// could start (i.e., of an Action's prereqs)
+	Links []string `json:"links,omitempty"`
+	// Name is the name of the Action, or "procedure" for the Procedure
+	Name       string            `json:"name"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Duration is the amount of time covered by the span
+func (s Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Exporter receives spans as they end. It must be safe for concurrent use.
+type Exporter interface {
+	Export(span Span)
+}
+
+type exporterKey struct{}
+
+// WithExporter returns a context that causes the Procedures and Actions
+// executed with it to export spans to e
+func WithExporter(ctx context.Context, e Exporter) context.Context {
+	return context.WithValue(ctx, exporterKey{}, e)
+}
+
+var defaultExporter Exporter
+
+// SetDefaultExporter sets the Exporter used for executions whose context
+// has none. It is not safe to call once Procedures are being executed.
+func SetDefaultExporter(e Exporter) {
+	defaultExporter = e
+}
+
+// exporterFrom returns the Exporter for the context, or nil if spans
+// should not be recorded
+func exporterFrom(ctx context.Context) Exporter {
+	if e, ok := ctx.Value(exporterKey{}).(Exporter); ok {
+		return e
+	}
+	return defaultExporter
+}
+
+func newSpanID() string {
+	return fmt.Sprintf("%016x", rand.Int63())
+}
+
+// tracer records the spans of an execution
+type tracer struct {
+	exporter Exporter
+	traceID  string
+	// rootID is the span of the Procedure, if any
+	rootID string
+}
+
+// newTracer returns a tracer for an execution, or nil if spans should not
+// be recorded
+func newTracer(ctx context.Context) *tracer {
+	e := exporterFrom(ctx)
+	if e == nil {
+		return nil
+	}
+	return &tracer{exporter: e, traceID: newSpanID() + newSpanID()}
+}
+
+// startRoot allocates the span of the Procedure, so that the spans of the
+// Actions can refer to it
+func (t *tracer) startRoot() {
+	if t != nil {
+		t.rootID = newSpanID()
+	}
+}
+
+// endRoot exports the span of the Procedure
+func (t *tracer) endRoot(start time.Time, attributes map[string]string) {
+	if t == nil || t.rootID == "" {
+		return
+	}
+	t.exporter.Export(Span{
+		TraceID:    t.traceID,
+		SpanID:     t.rootID,
+		Name:       "procedure",
+		Start:      start,
+		End:        time.Now(),
+		Attributes: attributes,
+	})
+}
+
+// endAction exports the span of the node's Action, which must have
+// completed, and records its SpanID for the spans of its dependents
+func (t *tracer) endAction(n *node, start, end time.Time) {
+	if t == nil {
+		return
+	}
+	n.spanID = newSpanID()
+	var links []string
+	for _, prereq := range n.prereqs {
+		links = append(links, prereq.spanID)
+	}
+	attributes := map[string]string{
+		"status":  describe(n.result),
+		"message": n.result.Message,
+	}
+	if n.err != nil {
+		attributes["error"] = n.err.Error()
+	}
+	t.exporter.Export(Span{
+		TraceID:    t.traceID,
+		SpanID:     n.spanID,
+		ParentID:   t.rootID,
+		Links:      links,
+		Name:       n.action.Name,
+		Start:      start,
+		End:        end,
+		Attributes: attributes,
+	})
+}
+
+// MemoryExporter keeps the spans it receives in memory. It is intended for
+// tests.
+type MemoryExporter struct {
+	mutex sync.Mutex
+	spans []Span
+}
+
+// Export records the span
+func (m *MemoryExporter) Export(span Span) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.spans = append(m.spans, span)
+}
+
+// Spans returns the spans received so far, in the order they ended
+func (m *MemoryExporter) Spans() []Span {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]Span{}, m.spans...)
+}
+
+// JSONExporter writes each span it receives to a Writer as a line of JSON
+type JSONExporter struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewJSONExporter returns a JSONExporter that writes to w (e.g., os.Stdout)
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{encoder: json.NewEncoder(w)}
+}
+
+// Export writes the span. Spans that cannot be written are dropped since
+// tracing must not interfere with reconciling.
+func (j *JSONExporter) Export(span Span) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	_ = j.encoder.Encode(span)
+}
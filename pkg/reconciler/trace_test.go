@@ -0,0 +1,116 @@
+package reconciler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestProcedureSpans(t *testing.T) {
+	a := NewAction("a", []*Action{}, trueAction.action)
+	b := NewAction("b", []*Action{a}, trueAction.action)
+	failing := NewAction("failing", []*Action{}, errorAction.action)
+	blocked := NewAction("blocked", []*Action{b, failing}, trueAction.action)
+	p := MustNewProcedure(0, 3, []*Action{blocked})
+
+	var exporter MemoryExporter
+	ctx := WithKind(WithExporter(context.TODO(), &exporter), "TraceTest")
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "name", Namespace: "namespace"}}
+	client := fake.NewFakeClient()
+	_, _ = p.Execute(ctx, request, client, nil)
+
+	spans := make(map[string]Span)
+	for _, span := range exporter.Spans() {
+		spans[span.Name] = span
+	}
+	if len(spans) != 5 {
+		t.Fatalf("expected 5 spans; got %v", exporter.Spans())
+	}
+	root := spans["procedure"]
+	wantRoot := map[string]string{
+		"kind":            "TraceTest",
+		"version":         "3",
+		"phase":           "apply",
+		"namespace":       "namespace",
+		"name":            "name",
+		"fullyReconciled": "false",
+	}
+	for key, value := range wantRoot {
+		if root.Attributes[key] != value {
+			t.Errorf("procedure span attribute %s: expected %q; got %q", key, value, root.Attributes[key])
+		}
+	}
+	if root.Attributes["error"] == "" || root.ParentID != "" {
+		t.Errorf("unexpected procedure span: %+v", root)
+	}
+
+	for _, name := range []string{"a", "b", "failing", "blocked"} {
+		span := spans[name]
+		if span.TraceID != root.TraceID || span.ParentID != root.SpanID {
+			t.Errorf("span %s is not a child of the procedure span: %+v", name, span)
+		}
+		if span.Start.Before(root.Start) || span.End.After(root.End) {
+			t.Errorf("span %s is not within the procedure span", name)
+		}
+	}
+	if links := spans["b"].Links; len(links) != 1 || links[0] != spans["a"].SpanID {
+		t.Errorf("span b should link to a; got %v", links)
+	}
+	if links := spans["blocked"].Links; len(links) != 2 {
+		t.Errorf("span blocked should link to its prereqs; got %v", links)
+	}
+	if attrs := spans["blocked"].Attributes; attrs["status"] != "Unknown" || attrs["message"] != "prequisite failing not met" {
+		t.Errorf("unexpected attributes for blocked: %v", attrs)
+	}
+	if attrs := spans["failing"].Attributes; attrs["error"] != errGeneric.Error() {
+		t.Errorf("unexpected attributes for failing: %v", attrs)
+	}
+	if attrs := spans["a"].Attributes; attrs["status"] != "True" || attrs["message"] != "it's true" {
+		t.Errorf("unexpected attributes for a: %v", attrs)
+	}
+}
+
+func TestNoSpansWithoutExporter(t *testing.T) {
+	client := fake.NewFakeClient()
+	run := newExecution(context.TODO(), reconcile.Request{}, client, nil)
+	if run.tracer != nil {
+		t.Errorf("executions should not be traced without an exporter")
+	}
+}
+
+func TestJSONExporter(t *testing.T) {
+	var b bytes.Buffer
+	exporter := NewJSONExporter(&b)
+	start := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	spans := []Span{
+		{TraceID: "t", SpanID: "1", Name: "procedure", Start: start, End: start.Add(time.Second)},
+		{TraceID: "t", SpanID: "2", ParentID: "1", Links: []string{"3"}, Name: "a",
+			Start: start, End: start, Attributes: map[string]string{"status": "True"}},
+	}
+	for _, span := range spans {
+		exporter.Export(span)
+	}
+
+	scanner := bufio.NewScanner(&b)
+	var i int
+	for ; scanner.Scan(); i++ {
+		var got Span
+		if err := json.Unmarshal(scanner.Bytes(), &got); err != nil {
+			t.Fatalf("line %d is not a span: %v", i, err)
+		}
+		if got.SpanID != spans[i].SpanID || got.ParentID != spans[i].ParentID ||
+			got.Duration() != spans[i].Duration() || got.Attributes["status"] != spans[i].Attributes["status"] {
+			t.Errorf("line %d: expected %+v; got %+v", i, spans[i], got)
+		}
+	}
+	if i != len(spans) {
+		t.Errorf("expected %d lines; got %d", len(spans), i)
+	}
+}
@@ -0,0 +1,142 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// UpgradePath returns the Procedures that have to be fully reconciled, in
+// order, to move from currentVersion to the newest Procedure. Each step must
+// be compatible with the version reached by the previous one, and the path
+// with the fewest steps is chosen, preferring larger jumps. If currentVersion
+// is nil or already the newest version, the path is just the newest
+// Procedure. If currentVersion is newer than all the Procedures (e.g., after
+// the operator was downgraded), the path is the newest compatible one.
+func (pl ProcedureList) UpgradePath(currentVersion *int) ([]*Procedure, error) {
+	if len(pl) < 1 {
+		return nil, errors.New("empty list of reconcile procedures")
+	}
+	sorted := pl.sorted()
+	newest := sorted[0].Version()
+	if currentVersion == nil || *currentVersion >= newest {
+		p, err := pl.NewestCompatible(currentVersion)
+		if err != nil {
+			return nil, err
+		}
+		return []*Procedure{p}, nil
+	}
+
+	// Breadth-first search over the versions reached, so the first path to
+	// reach the newest version is one of the shortest. Since the Procedures
+	// are tried newest first, larger jumps are preferred among those.
+	// previous maps each version reached to the one it was reached from.
+	previous := map[int]int{}
+	queue := []int{*currentVersion}
+	for len(queue) > 0 {
+		version := queue[0]
+		queue = queue[1:]
+		for i := range sorted {
+			next := sorted[i].Version()
+			if next <= version || sorted[i].MinVersion() > version {
+				continue
+			}
+			if _, ok := previous[next]; ok {
+				continue
+			}
+			previous[next] = version
+			if next == newest {
+				return pl.pathTo(next, *currentVersion, previous), nil
+			}
+			queue = append(queue, next)
+		}
+	}
+
+	return nil, fmt.Errorf("no upgrade path from deployed version %d to version %d",
+		*currentVersion, newest)
+}
+
+// Deployed returns the Procedure w/ the version that a CR was last fully
+// reconciled w/, e.g., to tear the CR down w/ the Procedure that deployed
+// it. If version is nil, or there is no such Procedure any more, it returns
+// the newest Procedure, so that the CR can still be torn down.
+func (pl ProcedureList) Deployed(version *int) (*Procedure, error) {
+	if version != nil {
+		if p := pl.find(*version); p != nil {
+			return p, nil
+		}
+	}
+	return pl.Newest()
+}
+
+// pathTo returns the Procedures leading from start to target, as found by
+// UpgradePath
+func (pl ProcedureList) pathTo(target, start int, previous map[int]int) []*Procedure {
+	var path []*Procedure
+	for version := target; version != start; version = previous[version] {
+		path = append([]*Procedure{pl.find(version)}, path...)
+	}
+	return path
+}
+
+// find returns the Procedure with the given version, or nil if there is none
+func (pl ProcedureList) find(version int) *Procedure {
+	for i := range pl {
+		if pl[i].Version() == version {
+			p := pl[i]
+			return &p
+		}
+	}
+	return nil
+}
+
+// Migration migrates the system from the layout used by an older Procedure
+// version to the one used by the Procedure the Migration belongs to.
+type Migration func(ctx context.Context, fromVersion int, request reconcile.Request, client client.Client, scheme *runtime.Scheme) error
+
+// WithMigration sets a Migration to run when a CR moves to this Procedure's
+// version from an older one.
+func WithMigration(migration Migration) ProcedureOption {
+	return func(p *Procedure) {
+		p.migration = migration
+	}
+}
+
+// Migrate runs the Procedure's Migration, if any, for a CR that is moving
+// from currentVersion to the Procedure's version. It should be called before
+// the Procedure is first executed for the CR, so that the Procedure's actions
+// find the layout they expect. Nothing is done if the CR had no version
+// (i.e., it is new) or is already at the Procedure's version. Callers record
+// that the Migration completed (e.g., in the status of the CR) so that it
+// only runs once per version; one that fails is retried, so it must cope w/
+// its own partial changes. Failures can be recorded w/ MigrationStatus.
+func (p *Procedure) Migrate(ctx context.Context, currentVersion *int, request reconcile.Request, client client.Client, scheme *runtime.Scheme) error {
+	if p.migration == nil || currentVersion == nil || *currentVersion >= p.version {
+		return nil
+	}
+	// The error is returned as-is so that its class is preserved
+	return p.migration(ctx, *currentVersion, request, client, scheme)
+}
+
+// MigrationAction is the name under which the result of a Migration is
+// reported
+const MigrationAction = "migration"
+
+// MigrationStatus returns the ProcedureStatus and error to record for a CR
+// whose Migration failed w/ err, instead of those of executing the
+// Procedure. The Migration is reported as a failed action, so that it shows
+// up in the CR's conditions, Events and history, and errors are classified
+// as those of actions are (e.g., terminal errors cause a Failure).
+func MigrationStatus(err error) (*ProcedureStatus, error) {
+	ar := ActionResult{Name: MigrationAction, Transient: IsTransient(err)}
+	ar.Result, ar.Err = reportError(Result{}, err)
+	status := &ProcedureStatus{Results: []ActionResult{ar}, RequeueAfter: ar.RequeueAfter}
+	if ar.Err != nil {
+		return status, Errors{&ActionError{Action: MigrationAction, Err: ar.Err}}
+	}
+	return status, nil
+}
@@ -0,0 +1,172 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestUpgradePath(t *testing.T) {
+	v3 := Procedure{version: 3, minVersion: 1, actions: []*Action{&trueAction}}
+	v5 := Procedure{version: 5, minVersion: 3, actions: []*Action{&trueAction}}
+	v6 := Procedure{version: 6, minVersion: 3, actions: []*Action{&trueAction}}
+	v10 := Procedure{version: 10, minVersion: 6, actions: []*Action{&trueAction}}
+	long := ProcedureList{v10, v3, v5, v6}
+
+	var tests = []struct {
+		list     ProcedureList
+		current  *int
+		expected []int
+	}{
+		{pl, nil, []int{9}},
+		{pl, intPtr(9), []int{9}},
+		{pl, intPtr(7), []int{9}},
+		// No single jump is possible from v2
+		{pl, intPtr(2), []int{7, 9}},
+		{pl, intPtr(4), []int{7, 9}},
+		// Newer than all procedures
+		{pl, intPtr(12), []int{9}},
+		// The larger jump (to v6) is preferred when paths are equally
+		// short
+		{long, intPtr(1), []int{3, 6, 10}},
+		{long, intPtr(4), []int{6, 10}},
+	}
+	for _, test := range tests {
+		path, err := test.list.UpgradePath(test.current)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			continue
+		}
+		var versions []int
+		for _, p := range path {
+			versions = append(versions, p.Version())
+		}
+		if len(versions) != len(test.expected) {
+			t.Errorf("expected path %v; got %v", test.expected, versions)
+			continue
+		}
+		for i := range versions {
+			if versions[i] != test.expected[i] {
+				t.Errorf("expected path %v; got %v", test.expected, versions)
+				break
+			}
+		}
+	}
+}
+
+func TestUpgradePathErrors(t *testing.T) {
+	var empty ProcedureList
+	if _, err := empty.UpgradePath(intPtr(1)); err == nil {
+		t.Error("UpgradePath() should fail for an empty list")
+	}
+	// Nothing is compatible w/ v1
+	if _, err := pl.UpgradePath(intPtr(1)); err == nil {
+		t.Error("UpgradePath() should fail when there is no path")
+	}
+}
+
+func TestDeployed(t *testing.T) {
+	var tests = []struct {
+		version *int
+		want    int
+	}{
+		{nil, 9},
+		{intPtr(7), 7},
+		{intPtr(8), 8},
+		// Unknown versions fall back to the newest
+		{intPtr(5), 9},
+		{intPtr(10), 9},
+	}
+	for _, tt := range tests {
+		p, err := pl.Deployed(tt.version)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", tt.version, err)
+		}
+		if p.Version() != tt.want {
+			t.Errorf("%v: expected version %d; got %d", tt.version, tt.want, p.Version())
+		}
+	}
+	var empty ProcedureList
+	if _, err := empty.Deployed(nil); err == nil {
+		t.Error("Deployed() should fail for an empty list")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	var calls []int
+	errMigration := errors.New("migration failed")
+	migration := func(_ context.Context, from int, _ reconcile.Request, _ client.Client, _ *runtime.Scheme) error {
+		calls = append(calls, from)
+		if from == 1 {
+			return Terminal(errMigration)
+		}
+		return nil
+	}
+	p := MustNewProcedure(2, 5, []*Action{&trueAction}, WithMigration(migration))
+	client := fake.NewFakeClient()
+
+	for _, current := range []*int{nil, intPtr(5), intPtr(6)} {
+		if err := p.Migrate(context.TODO(), current, reconcile.Request{}, client, nil); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if len(calls) != 0 {
+		t.Errorf("migration should only run for older versions; ran from %v", calls)
+	}
+
+	if err := p.Migrate(context.TODO(), intPtr(3), reconcile.Request{}, client, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err := p.Migrate(context.TODO(), intPtr(1), reconcile.Request{}, client, nil)
+	if !IsTerminal(err) {
+		t.Errorf("the migration's error should be returned as-is; got: %v", err)
+	}
+	if len(calls) != 2 || calls[0] != 3 || calls[1] != 1 {
+		t.Errorf("expected migrations from 3 and 1; got %v", calls)
+	}
+
+	// Procedures w/o a migration have nothing to do
+	if err := v7.Migrate(context.TODO(), intPtr(2), reconcile.Request{}, client, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestMigrationStatus(t *testing.T) {
+	var tests = []struct {
+		name        string
+		err         error
+		wantCond    corev1.ConditionStatus
+		wantErr     bool
+		wantFailure bool
+	}{
+		{"transient", Transient(errGeneric), corev1.ConditionUnknown, false, false},
+		{"retried", errGeneric, corev1.ConditionUnknown, true, false},
+		{"terminal", Terminal(errGeneric), corev1.ConditionFalse, true, true},
+	}
+	for _, tt := range tests {
+		status, err := MigrationStatus(tt.err)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if len(status.Results) != 1 || status.Results[0].Name != MigrationAction || status.Results[0].Status != tt.wantCond {
+			t.Errorf("%s: expected a %v %s action; got %+v", tt.name, tt.wantCond, MigrationAction, status.Results)
+		}
+		if status.FullyReconciled {
+			t.Errorf("%s: a failed migration can't be fully reconciled", tt.name)
+		}
+		failure, ferr := NewFailure(err, "spec")
+		if ferr != nil || (failure != nil) != tt.wantFailure {
+			t.Errorf("%s: expected a failure: %v; got %+v, %v", tt.name, tt.wantFailure, failure, ferr)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package reconciler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Validate checks that the Procedure's action graph can be executed: there
+// must be no nil actions or prereqs, no dependency cycles, and no two
+// distinct actions may share a name. Groups must have members. Each Value
+// may only be produced by one action, and must be produced by a prereq of
+// every action that consumes it.
+func (p *Procedure) Validate() error {
+	if p.minVersion > p.version {
+		return fmt.Errorf("procedure version %d: minimum version %d is greater than the version",
+			p.version, p.minVersion)
+	}
+	v := graphValidator{
+		names: make(map[string]*Action),
+		state: make(map[*Action]visitState),
+	}
+	listed := make(map[*Action]bool)
+	for i, a := range p.actions {
+		if a == nil {
+			return fmt.Errorf("procedure version %d: action %d is nil", p.version, i)
+		}
+		if listed[a] {
+			return fmt.Errorf("procedure version %d: action %s is listed more than once", p.version, a.Name)
+		}
+		listed[a] = true
+		if err := v.visit(a, nil); err != nil {
+			return fmt.Errorf("procedure version %d: %v", p.version, err)
+		}
+	}
+	if err := checkValues(p.graph().all()); err != nil {
+		return fmt.Errorf("procedure version %d: %v", p.version, err)
+	}
+	return nil
+}
+
+// Validate checks each Procedure in the list, and that no two of them have
+// the same version.
+func (pl ProcedureList) Validate() error {
+	versions := make(map[int]bool)
+	for i := range pl {
+		if versions[pl[i].Version()] {
+			return fmt.Errorf("procedure version %d is defined more than once", pl[i].Version())
+		}
+		versions[pl[i].Version()] = true
+		if err := pl[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type visitState int
+
+const (
+	unvisited visitState = iota
+	visiting
+	visited
+)
+
+// graphValidator walks an action graph depth-first, checking each action
+// once.
+type graphValidator struct {
+	// names maps each action name seen to the action that uses it
+	names map[string]*Action
+	// state tracks the progress of the walk through each action
+	state map[*Action]visitState
+}
+
+// visit checks the action and (recursively) its prereqs. path is the chain
+// of actions that led to this one, used to describe cycles.
+func (v *graphValidator) visit(a *Action, path []*Action) error {
+	switch v.state[a] {
+	case visited:
+		return nil
+	case visiting:
+		return fmt.Errorf("dependency cycle: %s", describeCycle(path, a))
+	}
+
+	if a.Name == "" {
+		return fmt.Errorf("action has no name (reached via: %s)", describePath(path))
+	}
+	if other, ok := v.names[a.Name]; ok && other != a {
+		return fmt.Errorf("more than one action is named %s", a.Name)
+	}
+	v.names[a.Name] = a
+	if a.action == nil && !a.group {
+		return fmt.Errorf("action %s has no action function", a.Name)
+	}
+	if a.group && len(a.prereqs) == 0 {
+		return fmt.Errorf("group %s has no members", a.Name)
+	}
+
+	v.state[a] = visiting
+	path = append(path, a)
+	for i, prereq := range a.prereqs {
+		if prereq == nil {
+			return fmt.Errorf("prereq %d of action %s is nil", i, a.Name)
+		}
+		if err := v.visit(prereq, path); err != nil {
+			return err
+		}
+	}
+	v.state[a] = visited
+	return nil
+}
+
+// checkValues verifies that each Value has a single producer, and that the
+// producer of each consumed Value is a (transitive) prereq of the consumer.
+// The graph must already be known to be free of cycles.
+func checkValues(actions []*Action) error {
+	producers := make(map[*Value]*Action)
+	for _, a := range actions {
+		for _, val := range a.produces {
+			if val == nil {
+				return fmt.Errorf("action %s produces a nil value", a.Name)
+			}
+			if other, ok := producers[val]; ok && other != a {
+				return fmt.Errorf("value %s is produced by both %s and %s", val.name, other.Name, a.Name)
+			}
+			producers[val] = a
+		}
+	}
+	for _, a := range actions {
+		for _, val := range a.consumes {
+			if val == nil {
+				return fmt.Errorf("action %s consumes a nil value", a.Name)
+			}
+			producer, ok := producers[val]
+			if !ok {
+				return fmt.Errorf("action %s consumes value %s, which no action produces", a.Name, val.name)
+			}
+			if producer != a && !dependsOn(a, producer, make(map[*Action]bool)) {
+				return fmt.Errorf("action %s consumes value %s, but its producer %s is not a prereq",
+					a.Name, val.name, producer.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// dependsOn returns true if target is a (transitive) prereq of a
+func dependsOn(a, target *Action, seen map[*Action]bool) bool {
+	for _, prereq := range a.prereqs {
+		if prereq == target {
+			return true
+		}
+		if seen[prereq] {
+			continue
+		}
+		seen[prereq] = true
+		if dependsOn(prereq, target, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// describePath returns the names of the actions in path, joined by arrows
+func describePath(path []*Action) string {
+	if len(path) == 0 {
+		return "procedure"
+	}
+	names := make([]string, 0, len(path))
+	for _, a := range path {
+		names = append(names, a.Name)
+	}
+	return strings.Join(names, " -> ")
+}
+
+// describeCycle returns the portion of path that starts and ends at a
+func describeCycle(path []*Action, a *Action) string {
+	for i := range path {
+		if path[i] == a {
+			path = path[i:]
+			break
+		}
+	}
+	return describePath(append(path, a))
+}
@@ -0,0 +1,82 @@
+package reconciler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidProcedure(t *testing.T) {
+	a := NewAction("a", []*Action{}, trueAction.action)
+	b := NewAction("b", []*Action{a}, trueAction.action)
+	c := NewAction("c", []*Action{a, b}, trueAction.action)
+	if _, err := NewProcedure(1, 2, []*Action{a, b, c}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestInvalidProcedures(t *testing.T) {
+	a := NewAction("a", []*Action{}, trueAction.action)
+	// cycle: x -> y -> z -> x
+	x := NewAction("x", []*Action{}, trueAction.action)
+	y := NewAction("y", []*Action{x}, trueAction.action)
+	z := NewAction("z", []*Action{y}, trueAction.action)
+	x.prereqs = []*Action{z}
+	self := NewAction("self", []*Action{}, trueAction.action)
+	self.prereqs = []*Action{self}
+	otherA := NewAction("a", []*Action{}, falseAction.action)
+	nilPrereq := NewAction("nilPrereq", []*Action{a, nil}, trueAction.action)
+	noFunc := NewAction("noFunc", []*Action{}, nil)
+	noName := NewAction("", []*Action{}, trueAction.action)
+
+	var tests = []struct {
+		minVersion int
+		actions    []*Action
+		wantErr    string
+	}{
+		{1, []*Action{a, y}, "dependency cycle: y -> x -> z -> y"},
+		{1, []*Action{self}, "dependency cycle: self -> self"},
+		{1, []*Action{a, otherA}, "more than one action is named a"},
+		{1, []*Action{NewAction("b", []*Action{otherA}, trueAction.action), a}, "more than one action is named a"},
+		{1, []*Action{a, a}, "listed more than once"},
+		{1, []*Action{a, nil}, "action 1 is nil"},
+		{1, []*Action{nilPrereq}, "prereq 1 of action nilPrereq is nil"},
+		{1, []*Action{noFunc}, "noFunc has no action function"},
+		{1, []*Action{NewGroup("empty", nil)}, "group empty has no members"},
+		{1, []*Action{NewAction("parent", []*Action{noName}, trueAction.action)}, "no name (reached via: parent)"},
+		{3, []*Action{a}, "minimum version 3 is greater"},
+	}
+	for _, test := range tests {
+		_, err := NewProcedure(test.minVersion, 2, test.actions)
+		if err == nil {
+			t.Errorf("expected error containing %q", test.wantErr)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("expected error containing %q; got: %v", test.wantErr, err)
+		}
+	}
+}
+
+func TestMustNewProcedurePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("MustNewProcedure should panic on an invalid procedure")
+		}
+	}()
+	MustNewProcedure(1, 1, []*Action{nil})
+}
+
+func TestProcedureListRejectsDuplicateVersions(t *testing.T) {
+	a := NewAction("a", []*Action{}, trueAction.action)
+	list := ProcedureList{
+		*MustNewProcedure(1, 1, []*Action{a}),
+		*MustNewProcedure(1, 2, []*Action{a}),
+	}
+	if err := list.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	list = append(list, *MustNewProcedure(2, 2, []*Action{a}))
+	if err := list.Validate(); err == nil {
+		t.Errorf("duplicate versions should be rejected")
+	}
+}
@@ -0,0 +1,139 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Value is a named, typed piece of data that is published by one Action for
+// use by the Actions that depend on it (e.g., the client endpoint of an etcd
+// cluster). Values only live for a single execution of a Procedure.
+//
+// The producing Action must declare the Value via Produces() and each
+// consuming Action via Consumes(). A consumer must have the producer as a
+// (direct or indirect) prereq; this is checked when the Procedure is
+// created.
+type Value struct {
+	name string
+	typ  reflect.Type
+}
+
+// NewValue declares a Value that holds data of the same type as example
+func NewValue(name string, example interface{}) *Value {
+	return &Value{
+		name: name,
+		typ:  reflect.TypeOf(example),
+	}
+}
+
+// Name is the name of the Value
+func (v *Value) Name() string {
+	return v.name
+}
+
+// Produces declares the Values that the Action publishes
+func Produces(values ...*Value) ActionOption {
+	return func(a *Action) {
+		a.produces = append(a.produces, values...)
+	}
+}
+
+// Consumes declares the Values that the Action reads
+func Consumes(values ...*Value) ActionOption {
+	return func(a *Action) {
+		a.consumes = append(a.consumes, values...)
+	}
+}
+
+// Set publishes the data for the Value. It may only be called by the Action
+// that produces the Value, from within its ActionFunc, using the context
+// that was passed to it.
+func (v *Value) Set(ctx context.Context, data interface{}) error {
+	s, err := scopeOf(ctx, v)
+	if err != nil {
+		return err
+	}
+	if !containsValue(s.action.produces, v) {
+		return fmt.Errorf("action %s does not produce value %s", s.action.Name, v.name)
+	}
+	if t := reflect.TypeOf(data); t == nil || !t.AssignableTo(v.typ) {
+		return fmt.Errorf("value %s holds %v, not %T", v.name, v.typ, data)
+	}
+	s.values.set(v, data)
+	return nil
+}
+
+// Get returns the data published for the Value. It may only be called by
+// an Action that consumes (or produces) the Value, from within its
+// ActionFunc, using the context that was passed to it.
+func (v *Value) Get(ctx context.Context) (interface{}, error) {
+	s, err := scopeOf(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+	if !containsValue(s.action.consumes, v) && !containsValue(s.action.produces, v) {
+		return nil, fmt.Errorf("action %s does not consume value %s", s.action.Name, v.name)
+	}
+	data, ok := s.values.get(v)
+	if !ok {
+		return nil, fmt.Errorf("value %s has not been published", v.name)
+	}
+	return data, nil
+}
+
+// valueStore holds the Values published during an execution
+type valueStore struct {
+	mutex sync.Mutex
+	data  map[*Value]interface{}
+}
+
+func newValueStore() *valueStore {
+	return &valueStore{data: make(map[*Value]interface{})}
+}
+
+func (vs *valueStore) set(v *Value, data interface{}) {
+	vs.mutex.Lock()
+	defer vs.mutex.Unlock()
+	vs.data[v] = data
+}
+
+func (vs *valueStore) get(v *Value) (interface{}, bool) {
+	vs.mutex.Lock()
+	defer vs.mutex.Unlock()
+	data, ok := vs.data[v]
+	return data, ok
+}
+
+// valueScope identifies the Action that is running and the store it may
+// access
+type valueScope struct {
+	action *Action
+	values *valueStore
+}
+
+type valueScopeKey struct{}
+
+// withValueScope returns a context that allows the Action to access the
+// store
+func withValueScope(ctx context.Context, a *Action, values *valueStore) context.Context {
+	return context.WithValue(ctx, valueScopeKey{}, valueScope{action: a, values: values})
+}
+
+func scopeOf(ctx context.Context, v *Value) (valueScope, error) {
+	s, ok := ctx.Value(valueScopeKey{}).(valueScope)
+	if !ok {
+		return s, fmt.Errorf("value %s is only available to actions during execution", v.name)
+	}
+	return s, nil
+}
+
+func containsValue(values []*Value, v *Value) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestValuesArePassedToDependents(t *testing.T) {
+	endpoint := NewValue("endpoint", "")
+	producer := NewAction("producer", []*Action{},
+		func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (Result, error) {
+			if err := endpoint.Set(ctx, "http://"+request.Name); err != nil {
+				return Result{}, err
+			}
+			return Result{Status: corev1.ConditionTrue}, nil
+		}, Produces(endpoint))
+	consumer := NewAction("consumer", []*Action{producer},
+		func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (Result, error) {
+			data, err := endpoint.Get(ctx)
+			if err != nil {
+				return Result{}, err
+			}
+			return Result{Status: corev1.ConditionTrue, Message: data.(string)}, nil
+		}, Consumes(endpoint))
+	p, err := NewProcedure(0, 1, []*Action{consumer})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "etcd", Namespace: "ns"}}
+	client := fake.NewFakeClient()
+	status, err := p.Execute(context.TODO(), request, client, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, r := range status.Results {
+		if r.Name == "consumer" && r.Message != "http://etcd" {
+			t.Errorf("consumer read %q", r.Message)
+		}
+	}
+}
+
+func TestValueAccessIsChecked(t *testing.T) {
+	count := NewValue("count", 0)
+	var tests = []struct {
+		name    string
+		options []ActionOption
+		use     func(ctx context.Context) error
+		wantErr string
+	}{
+		{"undeclaredSet", nil, func(ctx context.Context) error {
+			return count.Set(ctx, 1)
+		}, "does not produce value count"},
+		{"wrongType", []ActionOption{Produces(count)}, func(ctx context.Context) error {
+			return count.Set(ctx, "one")
+		}, "value count holds int, not string"},
+		{"nilData", []ActionOption{Produces(count)}, func(ctx context.Context) error {
+			return count.Set(ctx, nil)
+		}, "value count holds int"},
+		{"undeclaredGet", nil, func(ctx context.Context) error {
+			_, err := count.Get(ctx)
+			return err
+		}, "does not consume value count"},
+		{"unpublished", []ActionOption{Produces(count)}, func(ctx context.Context) error {
+			_, err := count.Get(ctx)
+			return err
+		}, "value count has not been published"},
+	}
+	for _, test := range tests {
+		use := test.use
+		a := NewAction(test.name, []*Action{},
+			func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (Result, error) {
+				return Result{Status: corev1.ConditionTrue}, use(ctx)
+			}, test.options...)
+		client := fake.NewFakeClient()
+		_, err := a.Execute(context.TODO(), reconcile.Request{}, client, nil)
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: expected error containing %q; got: %v", test.name, test.wantErr, err)
+		}
+	}
+
+	if err := count.Set(context.TODO(), 1); err == nil {
+		t.Errorf("values should not be available outside of an execution")
+	}
+}
+
+func TestValuesArePerExecution(t *testing.T) {
+	seen := NewValue("seen", "")
+	producer := NewAction("producer", []*Action{},
+		func(ctx context.Context, request reconcile.Request, client client.Client, scheme *runtime.Scheme) (Result, error) {
+			if _, err := seen.Get(ctx); err == nil {
+				return Result{}, fmt.Errorf("value leaked from a previous execution")
+			}
+			return Result{Status: corev1.ConditionTrue}, seen.Set(ctx, request.Name)
+		}, Produces(seen))
+	client := fake.NewFakeClient()
+	for i := 0; i < 2; i++ {
+		if _, err := producer.Execute(context.TODO(), reconcile.Request{}, client, nil); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestInvalidValueDeclarations(t *testing.T) {
+	v := NewValue("v", "")
+	producer := NewAction("producer", []*Action{}, trueAction.action, Produces(v))
+	otherProducer := NewAction("otherProducer", []*Action{}, trueAction.action, Produces(v))
+	unrelated := NewAction("unrelated", []*Action{}, trueAction.action, Consumes(v))
+	orphan := NewAction("orphan", []*Action{}, trueAction.action, Consumes(NewValue("orphan", 0)))
+	middle := NewAction("middle", []*Action{producer}, trueAction.action)
+	indirect := NewAction("indirect", []*Action{middle}, trueAction.action, Consumes(v))
+
+	var tests = []struct {
+		actions []*Action
+		wantErr string
+	}{
+		{[]*Action{producer, unrelated}, "action unrelated consumes value v, but its producer producer is not a prereq"},
+		{[]*Action{producer, otherProducer}, "value v is produced by both producer and otherProducer"},
+		{[]*Action{orphan}, "action orphan consumes value orphan, which no action produces"},
+		{[]*Action{NewAction("nilValue", []*Action{}, trueAction.action, Produces(nil))}, "nilValue produces a nil value"},
+		{[]*Action{indirect}, ""},
+	}
+	for _, test := range tests {
+		_, err := NewProcedure(0, 1, test.actions)
+		if test.wantErr == "" {
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("expected error containing %q; got: %v", test.wantErr, err)
+		}
+	}
+}